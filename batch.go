@@ -0,0 +1,235 @@
+package opensubs
+
+import (
+	xmlrpc "github.com/sqp/go-xmlrpc"
+
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+//-----------------------------------------------------------------------
+// Batch requests.
+//-----------------------------------------------------------------------
+
+// Server limits by call. Larger requests are split and the results merged.
+const (
+	DownloadBatchSize = 20  // Subtitle ids by DownloadSubtitles call.
+	SearchBatchSize   = 10  // Criteria by SearchSubtitles call.
+	SearchResultLimit = 500 // Results by SearchSubtitles call. Batches reaching it are split again.
+)
+
+// ErrIncompleteResults is returned when a single criterion reaches
+// SearchResultLimit: the server dropped the other results. Those received are
+// still used.
+var ErrIncompleteResults = errors.New("opensubs: search results truncated by the server")
+
+// Set the number of batch requests sent at once, when a search or download
+// is split. The default 1 sends them one after the other. (Chainable)
+func (q *Query) SetConcurrency(n int) *Query {
+	q.concurrency = n
+	return q
+}
+
+// Search all criteria, by batch.
+func (q *Query) search(ctx context.Context) error {
+	q.hashURLs(ctx)
+	if e := ctx.Err(); e != nil {
+		return e
+	}
+	if e := q.argErr(); e != nil {
+		return e
+	}
+	chunks := make([]xmlrpc.Array, chunkCount(len(q.listArgs), SearchBatchSize))
+	incomplete := make([][]int, len(chunks))
+	e := forChunks(ctx, len(q.listArgs), SearchBatchSize, q.concurrency, func(ctx context.Context, index, start, end int) (e error) {
+		chunks[index], incomplete[index], e = q.searchRange(ctx, start, end)
+		return e
+	})
+	if e != nil {
+		return e
+	}
+
+	var all []interface{}
+	var errs []error
+	for i, array := range chunks {
+		all = append(all, array...)
+		for _, arg := range incomplete[i] {
+			errs = append(errs, fmt.Errorf("search %v: %w", q.listArgs[arg], ErrIncompleteResults))
+		}
+	}
+	q.mapSubInfos(all)
+	return errors.Join(errs...)
+}
+
+// Search the criteria from start to end. A call reaching the result limit is
+// split in two, until a single criterion: those still reaching it are
+// returned as incomplete.
+func (q *Query) searchRange(ctx context.Context, start, end int) (xmlrpc.Array, []int, error) {
+	searchData, e := q.session.call(ctx, "SearchSubtitles", q.listArgs[start:end])
+	if e != nil {
+		return nil, nil, e
+	}
+	array, _ := searchData["data"].(xmlrpc.Array) // No match: data is false.
+
+	if len(array) >= SearchResultLimit && end-start > 1 {
+		mid := start + (end-start)/2
+		first, inc1, e := q.searchRange(ctx, start, mid)
+		if e != nil {
+			return nil, nil, e
+		}
+		second, inc2, e := q.searchRange(ctx, mid, end)
+		if e != nil {
+			return nil, nil, e
+		}
+		return append(first, second...), append(inc1, inc2...), nil
+	}
+
+	for _, value := range array {
+		if data, ok := value.(xmlrpc.Struct); ok {
+			shiftQueryNumber(data, start)
+		}
+	}
+	if len(array) >= SearchResultLimit {
+		return array, []int{start}, nil
+	}
+	return array, nil, nil
+}
+
+// Download subtitles files, by batch.
+// Downloads over the quota are deferred, see SetQuotaMode.
+//
+// The error is a *DownloadError listing every subtitle not downloaded: those
+// of the failed and unsent batches fail with the batch error, like the server
+// status or the context error.
+func (q *Query) download(ctx context.Context, ids []string, needed subIndex) (*Result, error) {
+	ids, deferred, qerr := q.checkQuota(ctx, ids)
+	if qerr != nil && deferred == nil { // Stop mode.
+		return newResult(), qerr
+	}
+
+	results := make([]*Result, chunkCount(len(ids), DownloadBatchSize))
+	errs := make([]error, len(results))
+	batchErrs := make([]error, len(results))
+	e := forChunks(ctx, len(ids), DownloadBatchSize, q.concurrency, func(ctx context.Context, index, start, end int) error {
+		s, e := q.session.call(ctx, "DownloadSubtitles", ids[start:end])
+		if errors.Is(e, ErrDownloadLimit) {
+			q.session.quotaReached()
+		}
+		if e != nil {
+			batchErrs[index] = e
+			return e
+		}
+		chunkNeeded := make(subIndex)
+		for _, id := range ids[start:end] {
+			chunkNeeded[id] = needed[id]
+		}
+		array, _ := s["data"].(xmlrpc.Array) // Missing data: all files will be reported as not returned.
+		q.session.useQuota(len(array))
+		results[index], errs[index] = q.parseSubFiles(array, chunkNeeded)
+		return nil
+	})
+
+	res := newResult()
+	dlerr := &DownloadError{}
+	for i, part := range results {
+		if part == nil { // Batch failed, or not sent after the first error.
+			cause := batchErrs[i]
+			if cause == nil {
+				cause = e
+			}
+			start := i * DownloadBatchSize
+			for _, id := range ids[start:min(start+DownloadBatchSize, len(ids))] {
+				dlerr.add(id, cause)
+			}
+			continue
+		}
+		res.merge(part)
+		var de *DownloadError
+		if errors.As(errs[i], &de) {
+			dlerr.Files = append(dlerr.Files, de.Files...)
+		}
+	}
+	for _, id := range deferred {
+		dlerr.add(id, qerr)
+	}
+	res.sortBest() // Batches are parsed in the server order.
+	return res, dlerr.err()
+}
+
+// Add the subtitles of other to the result.
+func (res *Result) merge(other *Result) {
+	res.byhash.merge(other.byhash)
+	res.byimdb.merge(other.byimdb)
+	res.bytag.merge(other.bytag)
+	res.bytext.merge(other.bytext)
+	res.byepisode.merge(other.byepisode)
+}
+
+func (byref subByRef) merge(other subByRef) {
+	for ref, bylang := range other {
+		for _, list := range bylang {
+			for _, sub := range list {
+				byref.addSub(sub, ref)
+			}
+		}
+	}
+}
+
+// The server numbers the matched criteria in each call. Make it the index in
+// the full list.
+func shiftQueryNumber(data xmlrpc.Struct, offset int) {
+	if value, ok := data["QueryNumber"]; ok && offset > 0 {
+		data["QueryNumber"] = strconv.Itoa(atoi(fmt.Sprint(value)) + offset)
+	}
+}
+
+func chunkCount(count, size int) int {
+	return (count + size - 1) / size
+}
+
+// Call fn for each chunk of size items, with at most workers calls at once.
+// The first error cancels the other calls and is returned.
+func forChunks(ctx context.Context, count, size, workers int, fn func(ctx context.Context, index, start, end int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		wg    sync.WaitGroup
+		once  sync.Once
+		first error
+		sem   = make(chan struct{}, workers)
+	)
+	fail := func(e error) {
+		once.Do(func() {
+			first = e
+			cancel()
+		})
+	}
+
+	for index, start := 0, 0; start < count; index, start = index+1, start+size {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if e := ctx.Err(); e != nil { // Also when the slot was picked first.
+			fail(e)
+			break
+		}
+
+		wg.Add(1)
+		go func(index, start, end int) {
+			defer func() { <-sem; wg.Done() }()
+			if e := fn(ctx, index, start, end); e != nil {
+				fail(e)
+			}
+		}(index, start, min(start+size, count))
+	}
+	wg.Wait()
+	return first
+}
@@ -0,0 +1,62 @@
+package opensubs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestForChunks(t *testing.T) {
+	tests := []struct {
+		count, size int
+		want        [][2]int
+	}{
+		{0, 10, nil},
+		{5, 10, [][2]int{{0, 5}}},
+		{25, 10, [][2]int{{0, 10}, {10, 20}, {20, 25}}},
+	}
+	for _, tt := range tests {
+		got := make([][2]int, chunkCount(tt.count, tt.size))
+		e := forChunks(context.Background(), tt.count, tt.size, 2, func(ctx context.Context, index, start, end int) error {
+			got[index] = [2]int{start, end}
+			return nil
+		})
+		if e != nil || len(got) != len(tt.want) {
+			t.Fatalf("forChunks(%d, %d) = %v, %d chunks, want %d", tt.count, tt.size, e, len(got), len(tt.want))
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("forChunks(%d, %d) chunk %d = %v, want %v", tt.count, tt.size, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestForChunksError(t *testing.T) {
+	errBatch := errors.New("batch failed")
+	e := forChunks(context.Background(), 30, 10, 1, func(ctx context.Context, index, start, end int) error {
+		if index == 1 {
+			return errBatch
+		}
+		return nil
+	})
+	if !errors.Is(e, errBatch) {
+		t.Errorf("forChunks() = %v, want %v", e, errBatch)
+	}
+}
+
+func TestForChunksCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 200; i++ { // The select picks at random between the free slot and Done.
+		var calls int32
+		e := forChunks(ctx, 3, 1, 1, func(ctx context.Context, index, start, end int) error {
+			atomic.AddInt32(&calls, 1)
+			return nil
+		})
+		if !errors.Is(e, context.Canceled) || calls != 0 {
+			t.Fatalf("forChunks(cancelled) = %v after %d calls, want %v and no call", e, calls, context.Canceled)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package opensubs
+
+import (
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+
+	"bytes"
+	"strings"
+	"unicode/utf8"
+
+	stdunicode "unicode"
+)
+
+//-----------------------------------------------------------------------
+// Charset conversion.
+//-----------------------------------------------------------------------
+
+// Byte order marks.
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// Legacy encodings tried by subtitle language (ISO 639-2), the most used
+// first. The common ones are tried after them, as the language can be wrong.
+var langCharsets = map[string][]string{
+	"alb": {"windows-1250"}, "bos": {"windows-1250"}, "hrv": {"windows-1250"},
+	"cze": {"windows-1250"}, "hun": {"windows-1250"}, "pol": {"windows-1250", "iso-8859-2"},
+	"rum": {"windows-1250"}, "scc": {"windows-1250", "windows-1251"}, "slo": {"windows-1250"},
+	"slv": {"windows-1250"},
+	"bel": {"windows-1251"}, "bul": {"windows-1251"}, "mac": {"windows-1251"},
+	"rus": {"windows-1251", "koi8-r"}, "ukr": {"windows-1251", "koi8-u"},
+	"ell": {"windows-1253"}, "gre": {"windows-1253", "iso-8859-7"},
+	"tur": {"windows-1254"},
+	"heb": {"windows-1255"},
+	"ara": {"windows-1256"}, "per": {"windows-1256"}, "urd": {"windows-1256"},
+	"est": {"windows-1257"}, "lav": {"windows-1257"}, "lit": {"windows-1257"},
+	"vie": {"windows-1258"},
+	"tha": {"windows-874"},
+	"chi": {"gbk", "big5"}, "zho": {"gbk", "big5"}, "zht": {"big5", "gbk"}, "zhe": {"big5", "gbk"},
+	"jpn": {"shift_jis", "euc-jp"},
+	"kor": {"euc-kr"},
+}
+
+var commonCharsets = []string{"windows-1252", "windows-1251", "windows-1253", "windows-1255", "windows-1256"}
+
+// Convert the subtitle to UTF-8 without BOM, with "\n" line endings. The
+// hint is the encoding given by the server (SubEncoding), and the language
+// selects the legacy encodings to try when the hint is wrong or missing.
+//
+// Returns the text and the name of the encoding found.
+func toUTF8(data []byte, hint, lang string) ([]byte, string) {
+	text, name := decodeText(data, hint, lang)
+	text = bytes.ReplaceAll(text, []byte("\r\n"), []byte("\n"))
+	text = bytes.ReplaceAll(text, []byte("\r"), []byte("\n"))
+	return text, name
+}
+
+func decodeText(data []byte, hint, lang string) ([]byte, string) {
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		return data[len(bomUTF8):], "utf-8"
+
+	case bytes.HasPrefix(data, bomUTF16LE):
+		if text, ok := decodeWith(unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM), data); ok {
+			return text, "utf-16le"
+		}
+
+	case bytes.HasPrefix(data, bomUTF16BE):
+		if text, ok := decodeWith(unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM), data); ok {
+			return text, "utf-16be"
+		}
+	}
+
+	if utf8.Valid(data) {
+		return data, "utf-8"
+	}
+	if order, ok := utf16Order(data); ok {
+		if text, ok := decodeWith(unicode.UTF16(order, unicode.IgnoreBOM), data); ok {
+			name := "utf-16le"
+			if order == unicode.BigEndian {
+				name = "utf-16be"
+			}
+			return text, name
+		}
+	}
+
+	// Try the hint and the language encodings, and keep the most readable.
+	var names []string
+	if enc, e := htmlindex.Get(hint); e == nil {
+		if name, _ := htmlindex.Name(enc); name != "utf-8" {
+			names = append(names, name)
+		}
+	}
+	names = append(names, langCharsets[strings.ToLower(lang)]...)
+	names = append(names, commonCharsets...)
+
+	var best []byte
+	bestName, bestScore := "", -1.0
+	for _, name := range names {
+		enc, e := htmlindex.Get(name)
+		if e != nil {
+			continue
+		}
+		text, ok := decodeWith(enc, data)
+		if !ok {
+			continue
+		}
+		if score := readability(text); score > bestScore {
+			best, bestName, bestScore = text, name, score
+		}
+	}
+	if best == nil {
+		return data, "" // Unknown: left as is.
+	}
+	return best, bestName
+}
+
+func decodeWith(enc encoding.Encoding, data []byte) ([]byte, bool) {
+	text, e := enc.NewDecoder().Bytes(data)
+	return text, e == nil
+}
+
+// Guess the byte order of UTF-16 text without BOM, from the zero bytes of
+// the latin characters and digits.
+func utf16Order(data []byte) (unicode.Endianness, bool) {
+	if len(data) < 4 || len(data)%2 != 0 {
+		return unicode.LittleEndian, false
+	}
+	var even, odd int
+	for i := 0; i+1 < len(data); i += 2 {
+		if data[i] == 0 {
+			even++
+		}
+		if data[i+1] == 0 {
+			odd++
+		}
+	}
+	half := float64(len(data) / 2)
+	switch {
+	case float64(odd) > half*0.3 && float64(even) < half*0.05:
+		return unicode.LittleEndian, true
+	case float64(even) > half*0.3 && float64(odd) < half*0.05:
+		return unicode.BigEndian, true
+	}
+	return unicode.LittleEndian, false
+}
+
+// Rate the decoded text from 0 to 1: the part of letters, digits, spaces
+// and common punctuation. Wrong encodings give symbols, control characters
+// or replacement characters, or a text made of accented latin letters when
+// the text wasn't in a latin script.
+func readability(text []byte) float64 {
+	var good, total, letters, accented int
+	for _, r := range string(text) {
+		total++
+		switch {
+		case r == utf8.RuneError:
+		case r == '\n' || r == '\r' || r == '\t':
+			good++
+		case stdunicode.IsControl(r):
+		case stdunicode.IsLetter(r):
+			good++
+			letters++
+			if r >= 0x80 && stdunicode.Is(stdunicode.Latin, r) {
+				accented++
+			}
+		case stdunicode.IsDigit(r), stdunicode.IsSpace(r):
+			good++
+		case stdunicode.IsPunct(r), strings.ContainsRune("<>♪", r):
+			good++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	score := float64(good) / float64(total)
+	if accented*2 > letters {
+		score /= 2
+	}
+	return score
+}
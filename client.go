@@ -0,0 +1,183 @@
+package opensubs
+
+import (
+	xmlrpc "github.com/sqp/go-xmlrpc"
+
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// OPENSUBTITLE_DOMAIN_HTTPS is the secure endpoint of the XML-RPC API.
+const OPENSUBTITLE_DOMAIN_HTTPS = "https://api.opensubtitles.org/xml-rpc"
+
+//-----------------------------------------------------------------------
+// Client.
+//-----------------------------------------------------------------------
+
+// Client sends the XML-RPC requests to the server.
+//
+// The zero value is not usable, create it with NewClient. A client can be
+// shared by many queries.
+//
+// Requests are spaced by the Limiter, and those failing with a temporary
+// error are sent again according to the Backoff. Both can be nil to disable
+// them.
+//
+type Client struct {
+	URL        string       // XML-RPC endpoint.
+	HTTPClient *http.Client // HTTP transport used for the requests.
+	Limiter    *RateLimiter // Spaces the requests.
+	Backoff    *Backoff     // Retries the temporary errors.
+}
+
+// DefaultClient is used by queries that weren't given a client.
+var DefaultClient = NewClient(OPENSUBTITLE_DOMAIN)
+
+// NewClient creates a client for the given XML-RPC endpoint. An empty URL
+// uses the default OpenSubtitles.org server.
+//
+// The client starts with its own http.Client, so it can be tuned (timeout,
+// proxy...) without changing the global http.DefaultClient. It respects the
+// server rate limit and retries temporary errors with the default backoff.
+//
+func NewClient(endpoint string) *Client {
+	if endpoint == "" {
+		endpoint = OPENSUBTITLE_DOMAIN
+	}
+	return &Client{
+		URL:        endpoint,
+		HTTPClient: &http.Client{},
+		Limiter:    NewRateLimiter(DefaultRateRequests, DefaultRateWindow),
+		Backoff:    NewBackoff(),
+	}
+}
+
+// SetHTTPS switches the endpoint scheme between http and https. (Chainable)
+//
+func (c *Client) SetHTTPS(secure bool) *Client {
+	switch {
+	case secure && strings.HasPrefix(c.URL, "http://"):
+		c.URL = "https://" + strings.TrimPrefix(c.URL, "http://")
+	case !secure && strings.HasPrefix(c.URL, "https://"):
+		c.URL = "http://" + strings.TrimPrefix(c.URL, "https://")
+	}
+	return c
+}
+
+// SetProxy routes the requests through the given proxy URL, for example
+// "http://proxy.example.com:3128". An empty string disables the proxy.
+//
+func (c *Client) SetProxy(proxy string) error {
+	var proxyFunc func(*http.Request) (*url.URL, error)
+	if proxy != "" {
+		u, e := url.Parse(proxy)
+		if e != nil {
+			return e
+		}
+		proxyFunc = http.ProxyURL(u)
+	}
+
+	tr, ok := c.transport()
+	if !ok {
+		return fmt.Errorf("proxy: unsupported transport %T", c.HTTPClient.Transport)
+	}
+	tr.Proxy = proxyFunc
+	return nil
+}
+
+// Get a private http.Transport we can configure.
+func (c *Client) transport() (*http.Transport, bool) {
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{}
+	}
+	switch tr := c.HTTPClient.Transport.(type) {
+	case nil:
+		clone := http.DefaultTransport.(*http.Transport).Clone()
+		c.HTTPClient.Transport = clone
+		return clone, true
+
+	case *http.Transport:
+		return tr, true
+	}
+	return nil, false
+}
+
+// Process a xmlrpc call on the server. The request is aborted when the
+// context is cancelled.
+//
+// A *StatusError is returned if the response status isn't a success, with
+// the response data as it can still hold useful informations.
+func (c *Client) call(ctx context.Context, name string, args ...interface{}) (xmlrpc.Struct, error) {
+	body, e := encodeCall(name, args...)
+	if e != nil {
+		return nil, e
+	}
+
+	for retry := 1; ; retry++ {
+		if e := c.Limiter.Wait(ctx); e != nil {
+			return nil, e
+		}
+		data, e := c.send(ctx, name, body)
+		if c.Backoff == nil || retry > c.Backoff.Retries || !retryable(e) {
+			return data, e
+		}
+
+		delay := c.Backoff.delay(retry, e)
+		if c.Backoff.OnRetry != nil {
+			c.Backoff.OnRetry(name, retry, delay, e)
+		}
+		if e := sleep(ctx, delay); e != nil {
+			return nil, e
+		}
+	}
+}
+
+// Send one request.
+func (c *Client) send(ctx context.Context, name string, body []byte) (xmlrpc.Struct, error) {
+	req, e := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(body))
+	if e != nil {
+		return nil, e
+	}
+	req.Header.Set("Content-Type", "text/xml")
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, e := httpClient.Do(req)
+	if e != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &transportError{e}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{
+			Method:     name,
+			Code:       resp.StatusCode,
+			Status:     resp.Status,
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	res, e := decodeResponse(resp.Body)
+	if e != nil {
+		switch {
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case errors.Is(e, io.ErrUnexpectedEOF): // Connection lost while reading.
+			return nil, &transportError{e}
+		}
+		return nil, e
+	}
+	data, _ := res.(xmlrpc.Struct)
+	return data, checkStatus(name, data)
+}
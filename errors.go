@@ -0,0 +1,158 @@
+package opensubs
+
+import (
+	xmlrpc "github.com/sqp/go-xmlrpc"
+
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//-----------------------------------------------------------------------
+// Server status errors.
+//-----------------------------------------------------------------------
+
+// StatusError is returned when the server answers with an error status.
+//
+// It can be matched by code with errors.Is and the Err values:
+//
+//	if errors.Is(e, opensubs.ErrDownloadLimit) { // back off until tomorrow.
+//
+type StatusError struct {
+	Method string // XML-RPC method called. Empty for the Err values.
+	Code   int    // Status code: 407.
+	Status string // Full status: "407 Download limit reached".
+
+	retryAfter time.Duration // Delay asked by the server before a retry.
+}
+
+func (e *StatusError) Error() string {
+	if e.Method == "" {
+		return "opensubs: " + e.Status
+	}
+	return "opensubs: " + e.Method + ": " + e.Status
+}
+
+// Is matches status errors with the same code.
+func (e *StatusError) Is(target error) bool {
+	t, ok := target.(*StatusError)
+	return ok && t.Code == e.Code
+}
+
+// Status errors documented by the API.
+var (
+	ErrUnauthorized       = newStatusError(401, "Unauthorized")
+	ErrInvalidFormat      = newStatusError(402, "Subtitles has invalid format")
+	ErrInvalidLanguage    = newStatusError(404, "Subtitles has invalid language")
+	ErrMissingParameters  = newStatusError(405, "Not all mandatory parameters was specified")
+	ErrNoSession          = newStatusError(406, "No session")
+	ErrDownloadLimit      = newStatusError(407, "Download limit reached")
+	ErrInvalidParameters  = newStatusError(408, "Invalid parameters")
+	ErrMethodNotFound     = newStatusError(409, "Method not found")
+	ErrUnknown            = newStatusError(410, "Other or unknown error")
+	ErrInvalidUserAgent   = newStatusError(411, "Empty or invalid useragent")
+	ErrInvalidImdb        = newStatusError(413, "Invalid ImdbID")
+	ErrUnknownUserAgent   = newStatusError(414, "Unknown User Agent")
+	ErrDisabledUserAgent  = newStatusError(415, "Disabled user agent")
+	ErrTooManyRequests    = newStatusError(429, "Too many requests")
+	ErrServiceUnavailable = newStatusError(503, "Service Unavailable")
+	ErrMaintenance        = newStatusError(506, "Server under maintenance")
+)
+
+// ErrEmptyResponse is returned when the server answer has no data.
+var ErrEmptyResponse = errors.New("opensubs: empty response")
+
+func newStatusError(code int, msg string) *StatusError {
+	return &StatusError{Code: code, Status: strconv.Itoa(code) + " " + msg}
+}
+
+// Parse the status code of a response: "200 OK" gives 200.
+func statusCode(res xmlrpc.Struct) int {
+	status, _ := res["status"].(string)
+	code, _ := strconv.Atoi(strings.SplitN(status, " ", 2)[0])
+	return code
+}
+
+// Check the response status of a xmlrpc call. Success codes are 2xx.
+// Responses without status (some methods don't send it) are accepted.
+func checkStatus(method string, res xmlrpc.Struct) error {
+	if res == nil {
+		return ErrEmptyResponse
+	}
+	status, ok := res["status"].(string)
+	if !ok {
+		return nil
+	}
+	code := statusCode(res)
+	if code >= 200 && code < 300 {
+		return nil
+	}
+	return &StatusError{Method: method, Code: code, Status: status}
+}
+
+// The server reports an expired or invalid token.
+func tokenExpired(e error) bool {
+	return errors.Is(e, ErrUnauthorized) || errors.Is(e, ErrNoSession)
+}
+
+//-----------------------------------------------------------------------
+// Download errors.
+//-----------------------------------------------------------------------
+
+// ErrNotReturned is set for subtitles requested but not sent by the server.
+var ErrNotReturned = errors.New("not returned by server")
+
+// SubError is the failure of one subtitle file.
+//
+type SubError struct {
+	ID  string // IDSubtitleFile. Empty if the server data was too broken to get it.
+	Err error
+}
+
+func (e *SubError) Error() string {
+	// Listed in a DownloadError: drop the prefix of the package errors.
+	return "subtitle " + e.ID + ": " + strings.TrimPrefix(e.Err.Error(), "opensubs: ")
+}
+
+func (e *SubError) Unwrap() error { return e.Err }
+
+// DownloadError lists the subtitles that failed during a download.
+// Results are still returned for the others.
+//
+type DownloadError struct {
+	Files []*SubError
+}
+
+func (e *DownloadError) Error() string {
+	if len(e.Files) == 1 {
+		return "opensubs: " + e.Files[0].Error()
+	}
+	msg := make([]string, len(e.Files))
+	for i, fe := range e.Files {
+		msg[i] = fe.Error()
+	}
+	return fmt.Sprintf("opensubs: %d subtitles failed: %s", len(e.Files), strings.Join(msg, "; "))
+}
+
+// Unwrap allows to match the files errors with errors.Is and errors.As.
+func (e *DownloadError) Unwrap() []error {
+	list := make([]error, len(e.Files))
+	for i, fe := range e.Files {
+		list[i] = fe
+	}
+	return list
+}
+
+func (e *DownloadError) add(id string, err error) {
+	e.Files = append(e.Files, &SubError{ID: id, Err: err})
+}
+
+// Returns the error if files failed, or nil.
+func (e *DownloadError) err() error {
+	if len(e.Files) == 0 {
+		return nil
+	}
+	return e
+}
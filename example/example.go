@@ -2,17 +2,26 @@ package main
 
 import (
 	"github.com/sqp/opensubs"
+	"context"
 	"flag"
 	"os"
 	"fmt"
 	//~ "io"
-	"path"
 )
 
 var dir   string
 // Command line options
 var langs string
 var imdb  string
+var user  string
+var pass  string
+var tokenFile string
+var resolve   bool
+var filter    string
+var policy    string
+var exists    string
+var naming    string
+var saveOpts  opensubs.SaveOptions
 
 const usage = `OpenSubs GO API Example is a tool to download subs files.
 
@@ -24,14 +33,15 @@ Examples:
 
   %s -l fre,ita,eng *.avi          # Download subs in 3 languages for all avi in dir.
   %s --imdb 1234567 my_movie.mkv   # Can also try to download subs for a specific movie.
+  %s --resolve *.mkv               # Try hash, then imdb, release name and title.
   
-Without the imdb setting, we only match the movie by moviehash.
+Without the imdb or resolve setting, we only match the movie by moviehash.
 
 `
 
 func init() {
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, usage, os.Args[0], os.Args[0], os.Args[0])
+		fmt.Fprintf(os.Stderr, usage, os.Args[0], os.Args[0], os.Args[0], os.Args[0])
 		flag.PrintDefaults()
 	}
 
@@ -39,24 +49,68 @@ func init() {
 	flag.StringVar(&langs, "l", "eng", "see --lang")
 	flag.StringVar(&imdb,  "imdb", "",    "imdb id for given file (only one file can be matched if used)")
 	flag.StringVar(&imdb,  "i", "",    "see --imdb")
+	flag.StringVar(&user,  "user", "",  "opensubtitles.org account (anonymous if empty)")
+	flag.StringVar(&pass,  "pass", "",  "opensubtitles.org password")
+	flag.StringVar(&tokenFile, "token", "", "file used to keep the login token between runs")
+	flag.StringVar(&filter, "filter", "", "drop unwanted subs, ex: !hi,!mt,format=srt,rating=6,rank=trusted|gold member,single-cd")
+	flag.StringVar(&policy, "policy", "3", "subs by language and preferences, ex: eng:2,fre:1 or eng,fre,spa,first or stophash")
+	flag.StringVar(&exists, "exists", "fail", "when the sub file exists: fail, skip, overwrite, keep (both) or backup")
+	flag.BoolVar(&saveOpts.Atomic, "atomic", false, "write sub files to a temporary file first, so a failed write leaves no partial file")
+	flag.StringVar(&naming, "naming", "default", "sub file names: default, plex, jellyfin, emby, kodi, or a template like {basename}.{lang2}{.forced}{.sdh}.{ext}")
+	flag.BoolVar(&resolve, "resolve", false, "find one sub per file and language, falling back from hash to imdb, release name and title")
 }
 
 func main() {
 	flag.Parse()
 	if flag.NArg() == 0 {
-		fmt.Println("Missing file name(s)\n")
+		fmt.Print("Missing file name(s)\n\n")
 		flag.Usage()
 		os.Exit(2)
 	}
 
-	get(langs, imdb, flag.Args())
+	subFilter, e := opensubs.ParseFilter(filter)
+	if e != nil {
+		fmt.Fprintln(os.Stderr, e)
+		os.Exit(2)
+	}
+
+	saveOpts.Mode, e = opensubs.ParseSaveMode(exists)
+	if e != nil {
+		fmt.Fprintln(os.Stderr, e)
+		os.Exit(2)
+	}
+
+	subPolicy, e := opensubs.ParsePolicy(policy)
+	if e != nil {
+		fmt.Fprintln(os.Stderr, e)
+		os.Exit(2)
+	}
+
+	if resolve {
+		e = resolveFiles(langs, subFilter, flag.Args())
+	} else {
+		e = get(langs, imdb, subFilter, subPolicy, flag.Args())
+	}
+	if e != nil {
+		fmt.Fprintln(os.Stderr, e)
+	}
 }
 
 const OPENSUBTITLE_USER_AGENT = "OS Test User Agent"
 
-func get(langs, imdb string, files []string) error {
+func get(langs, imdb string, subFilter opensubs.Filter, subPolicy *opensubs.Policy, files []string) error {
 	// Create a new opensubs query.
 	query := opensubs.NewQuery(OPENSUBTITLE_USER_AGENT)
+	if user != "" || tokenFile != "" { // Or use an account session.
+		session := opensubs.NewSession(OPENSUBTITLE_USER_AGENT, user, pass)
+		session.SetTokenFile(tokenFile)
+		if tokenFile == "" { // query.Logout doesn't close shared sessions.
+			defer session.Logout(context.Background())
+		}
+		query = opensubs.NewQuerySession(session)
+	}
+	query.SetFilter(subFilter) // Unwanted subs are never downloaded.
+	query.SetPolicy(subPolicy) // Number of subs by language.
 
 	// Fill the query with our input.
 	for _, file := range files {
@@ -86,26 +140,27 @@ func get(langs, imdb string, files []string) error {
 	query.PrintSubInfos() // Can be used to see the list of subtitles found.
 	
 	// Download subs files.
-	byhash, byimdb := query.Get(3)
-
-	if byhash != nil {
-		for file, bylang := range byhash { // For each ref.
-			basename := stripExt(file)
-			for lang, list := range bylang {
-				list[0].ToFile(basename + "_" + lang + ".srt") // One file is enough in moviehash mode.
-				// Others aren't downloaded. The slice level here is just to get a similar
-				// structure for byhash and byimdb.
-				// The number of files downloaded in moviehash mode  may evolve if there
-				// is needs. Feel free to ask for an API evolution.
-			}
+	result, e := query.GetResult(context.Background(), 3)
+	if e != nil { // Some files may have failed, others are still in the result.
+		fmt.Fprintln(os.Stderr, e)
+	}
+
+	for file, bylang := range result.Files() { // For each file matched by hash.
+		for _, lang := range bylang.Languages() {
+			save(bylang.Best(lang), file, saveOpts) // One file is enough in moviehash mode.
+			// Others aren't downloaded. The slice level here is just to get a similar
+			// structure for byhash and byimdb.
+			// The number of files downloaded in moviehash mode  may evolve if there
+			// is needs. Feel free to ask for an API evolution.
 		}
 	}
 	
-	for _, bylang := range byimdb {
-		basename := stripExt(files[0])
-		for lang, list := range bylang {
-			for index, sub := range list {
-				sub.ToFile(basename + "_" + lang + "_OS" + fmt.Sprint(index + 1) + ".srt")
+	for _, bylang := range result.Imdbs() {
+		for _, list := range bylang {
+			opts := saveOpts
+			for _, sub := range list {
+				save(sub, files[0], opts)
+				opts.Mode = opensubs.SaveKeepBoth // Next subs of the same lang get a number.
 			}
 		}
 		break // only one imdb can match
@@ -115,10 +170,37 @@ func get(langs, imdb string, files []string) error {
 }
 
 
-// Get filename without ext.
+// Find the best sub for each file and language, with the resolver fallback chain.
 //
-func stripExt(file string) string {
-	extLen := len(path.Ext(file))
-	return file[:len(file) - extLen]
+func resolveFiles(langs string, subFilter opensubs.Filter, files []string) error {
+	session := opensubs.NewSession(OPENSUBTITLE_USER_AGENT, user, pass)
+	session.SetTokenFile(tokenFile)
+	if tokenFile == "" { // Keep the token if we can reuse it.
+		defer session.Logout(context.Background())
+	}
+
+	resolver := opensubs.NewResolver(session)
+	resolver.Filter = subFilter
+	found, e := resolver.Resolve(context.Background(), langs, files...)
+	for file, bylang := range found {
+		for _, lang := range bylang.Languages() {
+			sub := bylang.Best(lang)
+			fmt.Println(file, lang, "found by", sub.Step)
+			save(sub, file, saveOpts)
+		}
+	}
+	return e
 }
 
+
+// Save the sub file next to the video, named with the command line template.
+//
+func save(sub *opensubs.SubInfo, video string, opts opensubs.SaveOptions) {
+	written, e := sub.SaveFor(video, opensubs.ParseNaming(naming), opts)
+	switch {
+	case e != nil:
+		fmt.Fprintln(os.Stderr, e)
+	case written == "":
+		fmt.Println("skipped", video, sub.SubLanguageID)
+	}
+}
@@ -0,0 +1,180 @@
+package opensubs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//-----------------------------------------------------------------------
+// Filters.
+//-----------------------------------------------------------------------
+
+// Filter selects candidate subtitles: it returns false for unwanted ones.
+// Filtered subtitles are never downloaded.
+//
+// Filters can be combined with And, Or and Not:
+//
+//	filter := opensubs.And(
+//		opensubs.Not(opensubs.HearingImpaired()),
+//		opensubs.Format("srt"),
+//		opensubs.MinRating(6),
+//	)
+//
+type Filter func(sub *SubInfo) bool
+
+// And matches subtitles matched by all filters.
+//
+func And(filters ...Filter) Filter {
+	return func(sub *SubInfo) bool {
+		for _, f := range filters {
+			if !f(sub) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or matches subtitles matched by at least one filter.
+//
+func Or(filters ...Filter) Filter {
+	return func(sub *SubInfo) bool {
+		for _, f := range filters {
+			if f(sub) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not matches subtitles not matched by the filter.
+//
+func Not(filter Filter) Filter {
+	return func(sub *SubInfo) bool { return !filter(sub) }
+}
+
+// HearingImpaired matches subtitles for the hearing impaired.
+//
+func HearingImpaired() Filter {
+	return func(sub *SubInfo) bool { return sub.HearingImpaired() }
+}
+
+// AutoTranslated matches machine translated subtitles.
+//
+func AutoTranslated() Filter {
+	return func(sub *SubInfo) bool { return sub.AutoTranslated() }
+}
+
+// SingleCD matches subtitles in one file.
+//
+func SingleCD() Filter {
+	return func(sub *SubInfo) bool { return sub.CDs() <= 1 }
+}
+
+// MinRating matches subtitles rated at least min (0 to 10).
+//
+func MinRating(min float64) Filter {
+	return func(sub *SubInfo) bool { return sub.Rating() >= min }
+}
+
+// Format matches subtitles in one of the formats: "srt", "sub"...
+//
+func Format(formats ...string) Filter {
+	return func(sub *SubInfo) bool { return containsFold(formats, sub.SubFormat) }
+}
+
+// UserRank matches subtitles uploaded by users with one of the ranks:
+// "trusted", "gold member", "platinum member", "administrator"...
+//
+func UserRank(ranks ...string) Filter {
+	return func(sub *SubInfo) bool { return containsFold(ranks, sub.UserRank) }
+}
+
+// Remove filtered subs from the list. The list isn't modified.
+func filterSubs(list subsList, filter Filter) subsList {
+	if filter == nil {
+		return list
+	}
+	var kept subsList
+	for _, sub := range list {
+		if filter(sub) {
+			kept = append(kept, sub)
+		}
+	}
+	return kept
+}
+
+func containsFold(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+//-----------------------------------------------------------------------
+// Filter from text.
+//-----------------------------------------------------------------------
+
+// ParseFilter creates a filter from a text description, for command line
+// options. Terms separated by comma must all match, and a term starting
+// with "!" is inverted. Values separated by "|" are alternatives.
+//
+//	hi                 hearing impaired
+//	mt                 machine translated
+//	single-cd          one file only
+//	rating=7           minimum rating
+//	format=srt|sub     formats
+//	rank=trusted|gold member  uploader ranks
+//
+// Example: "!hi,!mt,format=srt,rating=6".
+//
+func ParseFilter(text string) (Filter, error) {
+	var filters []Filter
+	for _, term := range strings.Split(text, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		not := strings.HasPrefix(term, "!")
+		term = strings.TrimPrefix(term, "!")
+		name, value, _ := strings.Cut(term, "=")
+
+		var f Filter
+		switch strings.ToLower(name) {
+		case "hi":
+			f = HearingImpaired()
+
+		case "mt":
+			f = AutoTranslated()
+
+		case "single-cd":
+			f = SingleCD()
+
+		case "rating":
+			min, e := strconv.ParseFloat(value, 64)
+			if e != nil {
+				return nil, fmt.Errorf("filter rating: %w", e)
+			}
+			f = MinRating(min)
+
+		case "format":
+			f = Format(strings.Split(value, "|")...)
+
+		case "rank":
+			f = UserRank(strings.Split(value, "|")...)
+
+		default:
+			return nil, fmt.Errorf("filter: unknown term %q", term)
+		}
+
+		if not {
+			f = Not(f)
+		}
+		filters = append(filters, f)
+	}
+	return And(filters...), nil
+}
@@ -0,0 +1,231 @@
+package opensubs
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+//-----------------------------------------------------------------------
+// Movie hash.
+//-----------------------------------------------------------------------
+
+// HashChunkSize is the size of the blocks read at the start and the end of
+// the file to compute the hash.
+const HashChunkSize = 64 * 1024
+
+// Hash errors.
+var (
+	ErrFileTooSmall   = errors.New("file too small to hash") // Smaller than HashChunkSize.
+	ErrNotRegularFile = errors.New("not a regular file")     // Directory, device, pipe...
+)
+
+// Hash returns the OpenSubtitles hash of the media of the given size: the
+// size plus the sum of the 64-bit words of the first and last 64 KiB, as 16
+// hexadecimal digits.
+//
+// Public Domain implementation by SQP, converted from the C version by Kamil
+// Dziobek. See http://trac.opensubtitles.org/projects/opensubtitles/wiki/HashSourceCodes
+//
+func Hash(r io.ReaderAt, size int64) (string, error) {
+	if size < HashChunkSize {
+		return "", ErrFileTooSmall
+	}
+
+	buffer := make([]byte, HashChunkSize*2) // Start and end blocks.
+	if e := readFull(r, buffer[:HashChunkSize], 0); e != nil {
+		return "", e
+	}
+	if e := readFull(r, buffer[HashChunkSize:], size-HashChunkSize); e != nil {
+		return "", e
+	}
+
+	hash := uint64(size)
+	for i := 0; i < len(buffer); i += 8 {
+		hash += binary.LittleEndian.Uint64(buffer[i : i+8])
+	}
+	return fmt.Sprintf("%016x", hash), nil
+}
+
+// HashFile returns the hash and the size of the file. Only regular files can
+// be hashed. Errors are *fs.PathError, with the filename.
+//
+func HashFile(filename string) (hash string, size int64, e error) {
+	file, e := os.Open(filename)
+	if e != nil {
+		return "", 0, e
+	}
+	defer file.Close()
+
+	stat, e := file.Stat()
+	if e != nil {
+		return "", 0, e
+	}
+	if !stat.Mode().IsRegular() {
+		return "", 0, &fs.PathError{Op: "hash", Path: filename, Err: ErrNotRegularFile}
+	}
+
+	hash, e = Hash(file, stat.Size())
+	if e != nil {
+		if _, ok := e.(*fs.PathError); !ok { // Read errors already have the path.
+			e = &fs.PathError{Op: "hash", Path: filename, Err: e}
+		}
+		return "", 0, e
+	}
+	return hash, stat.Size(), nil
+}
+
+// Read the block at offset. A short read is an error: the media was
+// truncated or its size was wrong.
+func readFull(r io.ReaderAt, block []byte, offset int64) error {
+	n, e := r.ReadAt(block, offset)
+	if n == len(block) {
+		return nil // ReadAt can return io.EOF with the last block.
+	}
+	if e == nil || e == io.EOF {
+		e = io.ErrUnexpectedEOF
+	}
+	return e
+}
+
+//-----------------------------------------------------------------------
+// Remote files.
+//-----------------------------------------------------------------------
+
+// Remote hash errors.
+var (
+	ErrUnknownSize = errors.New("unknown size")                 // No Content-Length in the HEAD response.
+	ErrNoRange     = errors.New("range requests not supported") // The server sent the whole file.
+)
+
+// HashURL returns the hash and the size of a file on a HTTP server, without
+// downloading it: a HEAD request gives the size, and two Range requests the
+// first and last 64 KiB. A nil client uses http.DefaultClient.
+//
+// Errors are *url.Error, with the URL.
+//
+func HashURL(ctx context.Context, client *http.Client, rawURL string) (hash string, size int64, e error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	r := &rangeReader{ctx: ctx, client: client, url: rawURL}
+	size, e = r.size()
+	if e != nil {
+		return "", 0, e
+	}
+	hash, e = Hash(r, size)
+	if e != nil {
+		if _, ok := e.(*url.Error); !ok {
+			e = &url.Error{Op: "Hash", URL: rawURL, Err: e}
+		}
+		return "", 0, e
+	}
+	return hash, size, nil
+}
+
+// URLHashTimeout is the time given to hash each file added with AddURL.
+var URLHashTimeout = 30 * time.Second
+
+// A file added with AddURL.
+type remoteFile struct {
+	url   string
+	path  string
+	langs string
+}
+
+// Hash the files added with AddURL, and add their search arguments.
+// The requests use the HTTP client of the session client.
+func (q *Query) hashURLs(ctx context.Context) {
+	var client *http.Client
+	if c := q.session.apiClient(); c != nil {
+		client = c.HTTPClient
+	}
+	for i, file := range q.urls {
+		if ctx.Err() != nil {
+			q.urls = q.urls[i:] // Kept for the next search. This one fails.
+			return
+		}
+		hash, size, e := hashURLTimeout(ctx, client, file.url)
+		if e != nil {
+			q.errs = append(q.errs, e)
+			continue
+		}
+		q.AddHash(hash, size, file.path, file.langs)
+	}
+	q.urls = nil
+}
+
+func hashURLTimeout(ctx context.Context, client *http.Client, rawURL string) (string, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, URLHashTimeout)
+	defer cancel()
+	return HashURL(ctx, client, rawURL)
+}
+
+// rangeReader reads a remote file with HTTP Range requests.
+type rangeReader struct {
+	ctx    context.Context
+	client *http.Client
+	url    string
+}
+
+// Get the size of the file with a HEAD request.
+func (r *rangeReader) size() (int64, error) {
+	resp, e := r.do(http.MethodHead, "")
+	if e != nil {
+		return 0, e
+	}
+	resp.Body.Close()
+	if resp.ContentLength < 0 {
+		return 0, &url.Error{Op: "Head", URL: r.url, Err: ErrUnknownSize}
+	}
+	return resp.ContentLength, nil
+}
+
+func (r *rangeReader) ReadAt(p []byte, offset int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	resp, e := r.do(http.MethodGet, fmt.Sprintf("bytes=%d-%d", offset, offset+int64(len(p))-1))
+	if e != nil {
+		return 0, e
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, &url.Error{Op: "Get", URL: r.url, Err: ErrNoRange}
+	}
+	n, e := io.ReadFull(resp.Body, p)
+	if e != nil {
+		return n, &url.Error{Op: "Get", URL: r.url, Err: e}
+	}
+	return n, nil
+}
+
+// Send the request, with the range if set. Error statuses are returned as
+// *url.Error.
+func (r *rangeReader) do(method, byteRange string) (*http.Response, error) {
+	req, e := http.NewRequestWithContext(r.ctx, method, r.url, nil)
+	if e != nil {
+		return nil, e
+	}
+	if byteRange != "" {
+		req.Header.Set("Range", byteRange)
+	}
+	resp, e := r.client.Do(req)
+	if e != nil {
+		return nil, e
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		op := method[:1] + strings.ToLower(method[1:]) // As net/http: "Get".
+		return nil, &url.Error{Op: op, URL: r.url, Err: errors.New(resp.Status)}
+	}
+	return resp, nil
+}
@@ -0,0 +1,130 @@
+package opensubs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// patternReader is a media of any size, without storage: the byte at offset
+// is offset % 251.
+type patternReader struct {
+	size int64
+}
+
+func (r patternReader) ReadAt(p []byte, offset int64) (int, error) {
+	n := 0
+	for ; n < len(p) && offset+int64(n) < r.size; n++ {
+		p[n] = byte((offset + int64(n)) % 251)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// shortReader claims a size, but ends before.
+type shortReader struct {
+	patternReader
+	end int64
+}
+
+func (r shortReader) ReadAt(p []byte, offset int64) (int, error) {
+	if offset >= r.end {
+		return 0, io.EOF
+	}
+	if left := r.end - offset; int64(len(p)) > left {
+		n, _ := r.patternReader.ReadAt(p[:left], offset)
+		return n, io.EOF
+	}
+	return r.patternReader.ReadAt(p, offset)
+}
+
+func TestHash(t *testing.T) {
+	tests := []struct {
+		name string
+		r    io.ReaderAt
+		size int64
+		want string
+		err  error
+	}{
+		{"one chunk", patternReader{65536}, 65536, "d48b4000b76d0d86", nil},
+		{"pattern", patternReader{200000}, 200000, "e19d5212c9812cd6", nil},
+		{"over 4 GiB", patternReader{4295033890}, 4295033890, "9c580dc9843ad973", nil},
+		{"leading zeros", zeroReader{}, 131072, "0000000000020000", nil},
+		{"too small", patternReader{100}, 100, "", ErrFileTooSmall},
+		{"empty", patternReader{0}, 0, "", ErrFileTooSmall},
+		{"short read", shortReader{patternReader{200000}, 150000}, 200000, "", io.ErrUnexpectedEOF},
+	}
+
+	for _, tt := range tests {
+		got, e := Hash(tt.r, tt.size)
+		if got != tt.want || !errors.Is(e, tt.err) {
+			t.Errorf("%s: Hash() = %q, %v, want %q, %v", tt.name, got, e, tt.want, tt.err)
+		}
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) ReadAt(p []byte, offset int64) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// Reference file published by OpenSubtitles, see HashSourceCodes on the wiki.
+// Copy it in testdata to check it.
+func TestHashFileReference(t *testing.T) {
+	filename := filepath.Join("testdata", "breakdance.avi")
+	if _, e := os.Stat(filename); e != nil {
+		t.Skip("reference file not found:", filename)
+	}
+	hash, size, e := HashFile(filename)
+	if e != nil || hash != "8e245d9679d31e12" || size != 12909756 {
+		t.Errorf("HashFile(%q) = %q, %d, %v, want %q, %d", filename, hash, size, e, "8e245d9679d31e12", 12909756)
+	}
+}
+
+func TestHashFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	small := filepath.Join(dir, "small.avi")
+	if e := os.WriteFile(small, make([]byte, 100), 0644); e != nil {
+		t.Fatal(e)
+	}
+
+	tests := []struct {
+		filename string
+		err      error
+	}{
+		{small, ErrFileTooSmall},
+		{dir, ErrNotRegularFile},
+		{filepath.Join(dir, "missing.avi"), os.ErrNotExist},
+	}
+	for _, tt := range tests {
+		_, _, e := HashFile(tt.filename)
+		var pathErr *os.PathError
+		if !errors.Is(e, tt.err) || !errors.As(e, &pathErr) {
+			t.Errorf("HashFile(%q) error = %v, want %v as *fs.PathError", tt.filename, e, tt.err)
+		}
+	}
+}
+
+type failTransport struct{ err error }
+
+func (t failTransport) RoundTrip(*http.Request) (*http.Response, error) { return nil, t.err }
+
+func TestAddURLClient(t *testing.T) {
+	errTransport := errors.New("query transport")
+	client := NewClient("")
+	client.HTTPClient = &http.Client{Transport: failTransport{errTransport}}
+
+	q := NewQuery("ua").SetClient(client).AddURL("http://nas.invalid/Movie.mkv", "", "eng")
+	q.hashURLs(context.Background())
+	if e := q.Err(); !errors.Is(e, errTransport) {
+		t.Errorf("Err() = %v, want the error of the query HTTP client", e)
+	}
+}
@@ -0,0 +1,288 @@
+package opensubs
+
+import (
+	xmlrpc "github.com/sqp/go-xmlrpc"
+
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+//-----------------------------------------------------------------------
+// Languages.
+//-----------------------------------------------------------------------
+
+// Language holds the codes and names of a subtitle language.
+//
+type Language struct {
+	ID       string // Server code, used as SubLanguageID: "fre", "pob".
+	ISO6391  string // ISO 639-1: "fr". Empty if none.
+	ISO6392B string // ISO 639-2/B: "fre".
+	ISO6392T string // ISO 639-2/T: "fra".
+	BCP47    string // BCP 47 tag: "fr", "pt-BR".
+	Name     string // English name: "French".
+	Native   string // Native name: "Français".
+}
+
+// Languages known by the server, with the server variants: "pob" for
+// brazilian portuguese, "zht" and "zhe" for traditional and bilingual chinese.
+var languageTable = []Language{
+	{"afr", "af", "afr", "afr", "af", "Afrikaans", "Afrikaans"},
+	{"alb", "sq", "alb", "sqi", "sq", "Albanian", "Shqip"},
+	{"ara", "ar", "ara", "ara", "ar", "Arabic", "العربية"},
+	{"arm", "hy", "arm", "hye", "hy", "Armenian", "Հայերեն"},
+	{"ast", "", "ast", "ast", "ast", "Asturian", "Asturianu"},
+	{"aze", "az", "aze", "aze", "az", "Azerbaijani", "Azərbaycan dili"},
+	{"baq", "eu", "baq", "eus", "eu", "Basque", "Euskara"},
+	{"bel", "be", "bel", "bel", "be", "Belarusian", "Беларуская"},
+	{"ben", "bn", "ben", "ben", "bn", "Bengali", "বাংলা"},
+	{"bos", "bs", "bos", "bos", "bs", "Bosnian", "Bosanski"},
+	{"bre", "br", "bre", "bre", "br", "Breton", "Brezhoneg"},
+	{"bul", "bg", "bul", "bul", "bg", "Bulgarian", "Български"},
+	{"bur", "my", "bur", "mya", "my", "Burmese", "မြန်မာ"},
+	{"cat", "ca", "cat", "cat", "ca", "Catalan", "Català"},
+	{"chi", "zh", "chi", "zho", "zh-CN", "Chinese (simplified)", "简体中文"},
+	{"zht", "zh", "chi", "zho", "zh-TW", "Chinese (traditional)", "繁體中文"},
+	{"zhe", "zh", "chi", "zho", "zh", "Chinese bilingual", "中文"},
+	{"hrv", "hr", "hrv", "hrv", "hr", "Croatian", "Hrvatski"},
+	{"cze", "cs", "cze", "ces", "cs", "Czech", "Čeština"},
+	{"dan", "da", "dan", "dan", "da", "Danish", "Dansk"},
+	{"dut", "nl", "dut", "nld", "nl", "Dutch", "Nederlands"},
+	{"eng", "en", "eng", "eng", "en", "English", "English"},
+	{"epo", "eo", "epo", "epo", "eo", "Esperanto", "Esperanto"},
+	{"est", "et", "est", "est", "et", "Estonian", "Eesti"},
+	{"fin", "fi", "fin", "fin", "fi", "Finnish", "Suomi"},
+	{"fre", "fr", "fre", "fra", "fr", "French", "Français"},
+	{"glg", "gl", "glg", "glg", "gl", "Galician", "Galego"},
+	{"geo", "ka", "geo", "kat", "ka", "Georgian", "ქართული"},
+	{"ger", "de", "ger", "deu", "de", "German", "Deutsch"},
+	{"ell", "el", "gre", "ell", "el", "Greek", "Ελληνικά"},
+	{"heb", "he", "heb", "heb", "he", "Hebrew", "עברית"},
+	{"hin", "hi", "hin", "hin", "hi", "Hindi", "हिन्दी"},
+	{"hun", "hu", "hun", "hun", "hu", "Hungarian", "Magyar"},
+	{"ice", "is", "ice", "isl", "is", "Icelandic", "Íslenska"},
+	{"ind", "id", "ind", "ind", "id", "Indonesian", "Bahasa Indonesia"},
+	{"gle", "ga", "gle", "gle", "ga", "Irish", "Gaeilge"},
+	{"ita", "it", "ita", "ita", "it", "Italian", "Italiano"},
+	{"jpn", "ja", "jpn", "jpn", "ja", "Japanese", "日本語"},
+	{"kan", "kn", "kan", "kan", "kn", "Kannada", "ಕನ್ನಡ"},
+	{"kaz", "kk", "kaz", "kaz", "kk", "Kazakh", "Қазақ тілі"},
+	{"khm", "km", "khm", "khm", "km", "Khmer", "ខ្មែរ"},
+	{"kor", "ko", "kor", "kor", "ko", "Korean", "한국어"},
+	{"kur", "ku", "kur", "kur", "ku", "Kurdish", "Kurdî"},
+	{"lav", "lv", "lav", "lav", "lv", "Latvian", "Latviešu"},
+	{"lit", "lt", "lit", "lit", "lt", "Lithuanian", "Lietuvių"},
+	{"ltz", "lb", "ltz", "ltz", "lb", "Luxembourgish", "Lëtzebuergesch"},
+	{"mac", "mk", "mac", "mkd", "mk", "Macedonian", "Македонски"},
+	{"may", "ms", "may", "msa", "ms", "Malay", "Bahasa Melayu"},
+	{"mal", "ml", "mal", "mal", "ml", "Malayalam", "മലയാളം"},
+	{"mar", "mr", "mar", "mar", "mr", "Marathi", "मराठी"},
+	{"mon", "mn", "mon", "mon", "mn", "Mongolian", "Монгол"},
+	{"nep", "ne", "nep", "nep", "ne", "Nepali", "नेपाली"},
+	{"nor", "no", "nor", "nor", "no", "Norwegian", "Norsk"},
+	{"oci", "oc", "oci", "oci", "oc", "Occitan", "Occitan"},
+	{"per", "fa", "per", "fas", "fa", "Persian", "فارسی"},
+	{"pol", "pl", "pol", "pol", "pl", "Polish", "Polski"},
+	{"por", "pt", "por", "por", "pt-PT", "Portuguese", "Português"},
+	{"pob", "pt", "por", "por", "pt-BR", "Portuguese (Brazil)", "Português (Brasil)"},
+	{"pus", "ps", "pus", "pus", "ps", "Pashto", "پښتو"},
+	{"rum", "ro", "rum", "ron", "ro", "Romanian", "Română"},
+	{"rus", "ru", "rus", "rus", "ru", "Russian", "Русский"},
+	{"gla", "gd", "gla", "gla", "gd", "Scottish Gaelic", "Gàidhlig"},
+	{"scc", "sr", "srp", "srp", "sr", "Serbian", "Српски"},
+	{"sin", "si", "sin", "sin", "si", "Sinhala", "සිංහල"},
+	{"slo", "sk", "slo", "slk", "sk", "Slovak", "Slovenčina"},
+	{"slv", "sl", "slv", "slv", "sl", "Slovenian", "Slovenščina"},
+	{"som", "so", "som", "som", "so", "Somali", "Soomaali"},
+	{"spa", "es", "spa", "spa", "es", "Spanish", "Español"},
+	{"swa", "sw", "swa", "swa", "sw", "Swahili", "Kiswahili"},
+	{"swe", "sv", "swe", "swe", "sv", "Swedish", "Svenska"},
+	{"tgl", "tl", "tgl", "tgl", "tl", "Tagalog", "Tagalog"},
+	{"tam", "ta", "tam", "tam", "ta", "Tamil", "தமிழ்"},
+	{"tat", "tt", "tat", "tat", "tt", "Tatar", "Татар"},
+	{"tel", "te", "tel", "tel", "te", "Telugu", "తెలుగు"},
+	{"tha", "th", "tha", "tha", "th", "Thai", "ไทย"},
+	{"tur", "tr", "tur", "tur", "tr", "Turkish", "Türkçe"},
+	{"ukr", "uk", "ukr", "ukr", "uk", "Ukrainian", "Українська"},
+	{"urd", "ur", "urd", "urd", "ur", "Urdu", "اردو"},
+	{"uzb", "uz", "uzb", "uzb", "uz", "Uzbek", "Oʻzbek"},
+	{"vie", "vi", "vie", "vie", "vi", "Vietnamese", "Tiếng Việt"},
+	{"wel", "cy", "wel", "cym", "cy", "Welsh", "Cymraeg"},
+}
+
+// ErrUnknownLanguage is returned for languages not found in the registry.
+var ErrUnknownLanguage = errors.New("unknown language")
+
+//-----------------------------------------------------------------------
+// Registry.
+//-----------------------------------------------------------------------
+
+// LanguageRegistry finds languages by code or name. It's safe for concurrent
+// use.
+//
+type LanguageRegistry struct {
+	mu    sync.RWMutex
+	list  []*Language
+	index map[string]*Language // Languages by lowercase code or name.
+}
+
+// DefaultLanguages is the registry used by queries, with the embedded table.
+var DefaultLanguages = NewLanguageRegistry()
+
+// NewLanguageRegistry creates a registry with the embedded table.
+//
+func NewLanguageRegistry() *LanguageRegistry {
+	r := &LanguageRegistry{index: make(map[string]*Language)}
+	for _, lang := range languageTable {
+		r.add(lang)
+	}
+	return r
+}
+
+// Add a language, or update the one with the same ID. The lock must be held
+// by callers other than the constructor.
+func (r *LanguageRegistry) add(lang Language) {
+	stored := r.index[strings.ToLower(lang.ID)]
+	if stored == nil || stored.ID != lang.ID {
+		stored = &lang
+		r.list = append(r.list, stored)
+	} else {
+		*stored = lang
+	}
+	for _, key := range []string{lang.ID, lang.ISO6392B, lang.ISO6392T, lang.ISO6391, lang.BCP47, lang.Name, lang.Native} {
+		r.alias(key, stored)
+	}
+	r.index[strings.ToLower(lang.ID)] = stored // The server code wins over the others.
+}
+
+// Index the language by key, unless the key is already used.
+func (r *LanguageRegistry) alias(key string, lang *Language) {
+	key = strings.ToLower(key)
+	if _, ok := r.index[key]; key != "" && !ok {
+		r.index[key] = lang
+	}
+}
+
+// Lookup finds a language by server code, ISO 639-1, ISO 639-2/B or /T code,
+// BCP 47 tag, english or native name, ignoring case. A tag with an unknown
+// region falls back to its language: "fr-CA" gives french.
+//
+func (r *LanguageRegistry) Lookup(name string) (Language, bool) {
+	key := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), "_", "-"))
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if lang, ok := r.index[key]; ok {
+		return *lang, true
+	}
+	if base, _, found := strings.Cut(key, "-"); found {
+		if lang, ok := r.index[base]; ok {
+			return *lang, true
+		}
+	}
+	return Language{}, false
+}
+
+// List returns the known languages.
+//
+func (r *LanguageRegistry) List() []Language {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]Language, len(r.list))
+	for i, lang := range r.list {
+		list[i] = *lang
+	}
+	return list
+}
+
+// Normalize converts a list of languages separated by comma to the server
+// codes: "en,fr-FR,French" gives "eng,fre". "all" is kept as is.
+//
+// Unknown languages are dropped and reported in the error, matching
+// ErrUnknownLanguage.
+//
+func (r *LanguageRegistry) Normalize(langs string) (string, error) {
+	var ids, unknown []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(langs, ",") {
+		name = strings.TrimSpace(name)
+		id := strings.ToLower(name)
+		if id != "all" {
+			lang, ok := r.Lookup(name)
+			if !ok {
+				if name != "" {
+					unknown = append(unknown, name)
+				}
+				continue
+			}
+			id = lang.ID
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(unknown) > 0 {
+		return strings.Join(ids, ","), fmt.Errorf("%w: %s", ErrUnknownLanguage, strings.Join(unknown, ", "))
+	}
+	return strings.Join(ids, ","), nil
+}
+
+// Refresh adds the languages of the server, with GetSubLanguages. Known
+// languages keep their informations, the new ones only have the server code,
+// name and ISO 639 code.
+//
+func (r *LanguageRegistry) Refresh(ctx context.Context, client *Client) error {
+	res, e := client.call(ctx, "GetSubLanguages", "en")
+	if e != nil {
+		return e
+	}
+	data, _ := res["data"].(xmlrpc.Array)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, value := range data {
+		fields, _ := value.(xmlrpc.Struct)
+		id, _ := fields["SubLanguageID"].(string)
+		name, _ := fields["LanguageName"].(string)
+		iso, _ := fields["ISO639"].(string)
+		if id == "" {
+			continue
+		}
+		if lang, ok := r.index[strings.ToLower(id)]; ok && lang.ID == id {
+			r.alias(iso, lang) // The server uses its own codes, like "pb" for pob.
+			continue
+		}
+		lang := Language{ID: id, ISO6392B: id, ISO6392T: id, BCP47: iso, Name: name}
+		if len(iso) == 2 {
+			lang.ISO6391 = iso
+		}
+		r.add(lang)
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------
+// Codes conversion.
+//-----------------------------------------------------------------------
+
+// ISO6391 converts a language code or name to ISO 639-1: "fre" or "fra"
+// gives "fr". Languages without ISO 639-1 code are returned as is.
+//
+func ISO6391(code string) string {
+	if lang, ok := DefaultLanguages.Lookup(code); ok && lang.ISO6391 != "" {
+		return lang.ISO6391
+	}
+	return code
+}
+
+// ISO6392 converts a language code or name to the ISO 639-2 code used by the
+// server: "fr" or "fra" gives "fre". Unknown codes are returned as is.
+//
+func ISO6392(code string) string {
+	if lang, ok := DefaultLanguages.Lookup(code); ok {
+		return lang.ID
+	}
+	return code
+}
@@ -0,0 +1,119 @@
+package opensubs
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+//-----------------------------------------------------------------------
+// Naming templates.
+//-----------------------------------------------------------------------
+
+// Naming is a template for subtitle filenames, with variables in braces:
+//
+//	{basename}  video path without extension: "/movies/Movie (2012)"
+//	{name}      video filename without path and extension: "Movie (2012)"
+//	{lang}      server language code (ISO 639-2/B): "fre"
+//	{lang2}     ISO 639-1 language code: "fr", or {lang} if none
+//	{lang3}     ISO 639-2/T language code: "fra"
+//	{langname}  language name in english: "French"
+//	{forced}    "forced" for subtitles only covering foreign parts
+//	{sdh}       "sdh" for subtitles for the hearing impaired
+//	{hi}        "hi" for subtitles for the hearing impaired
+//	{cc}        "cc" for subtitles for the hearing impaired
+//	{id}        subtitle file id
+//	{ext}       subtitle format: "srt"
+//
+// With a dot before the name, like {.forced}, the dot is only added when the
+// value isn't empty.
+//
+type Naming string
+
+// Naming presets for media servers.
+const (
+	NamingDefault  Naming = "{basename}.{lang}.{ext}"
+	NamingPlex     Naming = "{basename}.{lang2}{.forced}{.sdh}.{ext}"
+	NamingJellyfin Naming = "{basename}.{lang2}{.forced}{.sdh}.{ext}"
+	NamingEmby     Naming = "{basename}.{lang2}{.forced}.{ext}"
+	NamingKodi     Naming = "{basename}.{langname}{.forced}.{ext}"
+)
+
+var reNamingVar = regexp.MustCompile(`\{(\.?)(\w+)\}`)
+
+// ParseNaming returns a preset by name: "plex", "jellyfin", "emby", "kodi"
+// or "default". Other names are used as template.
+//
+func ParseNaming(name string) Naming {
+	switch strings.ToLower(name) {
+	case "", "default":
+		return NamingDefault
+	case "plex":
+		return NamingPlex
+	case "jellyfin":
+		return NamingJellyfin
+	case "emby":
+		return NamingEmby
+	case "kodi":
+		return NamingKodi
+	}
+	return Naming(name)
+}
+
+// Name returns the subtitle filename for the video. Unknown variables are
+// left as is.
+//
+func (n Naming) Name(video string, sub *SubInfo) string {
+	basename := strings.TrimSuffix(video, filepath.Ext(video))
+	flag := func(set bool, value string) string {
+		if set {
+			return value
+		}
+		return ""
+	}
+	ext := strings.ToLower(sub.SubFormat)
+	if ext == "" {
+		ext = "srt"
+	}
+	lang, ok := DefaultLanguages.Lookup(sub.SubLanguageID)
+	if !ok { // Unknown: use the server values.
+		lang = Language{ID: sub.SubLanguageID, ISO6391: sub.ISO639, ISO6392T: sub.SubLanguageID, Name: sub.LanguageName}
+	}
+	if lang.ISO6391 == "" { // No ISO 639-1 code.
+		lang.ISO6391 = lang.ID
+	}
+
+	vars := map[string]string{
+		"basename": basename,
+		"name":     filepath.Base(basename),
+		"lang":     sub.SubLanguageID,
+		"lang2":    lang.ISO6391,
+		"lang3":    lang.ISO6392T,
+		"langname": lang.Name,
+		"forced":   flag(sub.ForeignPartsOnly(), "forced"),
+		"sdh":      flag(sub.HearingImpaired(), "sdh"),
+		"hi":       flag(sub.HearingImpaired(), "hi"),
+		"cc":       flag(sub.HearingImpaired(), "cc"),
+		"id":       sub.IDSubtitleFile,
+		"ext":      ext,
+	}
+
+	return reNamingVar.ReplaceAllStringFunc(string(n), func(match string) string {
+		m := reNamingVar.FindStringSubmatch(match)
+		value, ok := vars[m[2]]
+		switch {
+		case !ok:
+			return match
+		case m[1] == "." && value != "":
+			return "." + value
+		}
+		return value
+	})
+}
+
+// SaveFor writes the downloaded file next to the video, named with the
+// template. See Save for the options and the returned path.
+//
+func (sub SubInfo) SaveFor(video string, naming Naming, opts SaveOptions) (string, error) {
+	return sub.Save(naming.Name(video, &sub), opts)
+}
@@ -1,10 +1,18 @@
 /*
 Package opensubs provides searching and downloading for subtitles on opensubtitles.org using their XMLRPC API.
 
-When matching by imdb, subs are sorted by download number.
+Subs are sorted by a Scorer to select the best ones, see DefaultScorer. Each
+selected SubInfo has the details of its score in Scoring. Unwanted subs can be
+dropped before the download with a Filter, and a Policy sets the number of subs
+downloaded by language and the language preferences.
+
+Searches and downloads are split in batches within the server limits, and the
+batches can be sent at once with SetConcurrency.
  
 
-Atm the output is converted from latin1 to UTF-8. I don't know if that can break other languages.
+Downloaded subs are converted to UTF-8 with "\n" line endings and no BOM. The
+encoding is detected from the server hint (SubEncoding), the byte order mark,
+and the subtitle language when the hint is wrong. It is set in SubInfo.Encoding.
 
 see example/example.go
 
@@ -19,19 +27,83 @@ see example/example.go
 	
 	// and / or by moviehash.
 	query.AddFile(filename, langs)
-	
+
+	// and / or by release name or full text, when there's no hash or imdb match.
+	query.AddTag("Some.Movie.2012.720p.BluRay.x264-GRP", "eng")
+	query.AddQuery("some movie 2012", "eng")
+
+	// and / or TV series episodes, by the series imdb id or name.
+	query.AddEpisode("0903747", 1, 2, "eng")
+
 	// Initiate server search query.
 	query.Search()
 	defer query.Logout()
 	
 	// Download files. The argument is the number of subtitles that should be
 	// downloaded for files matched in imdb mode.
-	byhash, byimdb := query.Get(3)   
+	byhash, byimdb := query.Get(3)
+
+A Resolver can also find the best subtitle for each file, trying the hash,
+then the imdb id, the release name and the title guessed from the filename:
+
+	found, e := opensubs.NewResolver(session).Resolve(ctx, "eng,fre", files...)
+	sub := found[filename].Best("eng") // sub.Step tells which step found it.
+
+The server endpoint and HTTP transport can be changed with a Client, to use
+https, a proxy, or a local test server:
+
+	client := opensubs.NewClient(opensubs.OPENSUBTITLE_DOMAIN_HTTPS)
+	client.SetProxy("http://proxy.example.com:3128")
+	query := opensubs.NewQuery(UserAgent).SetClient(client)
+
+Clients respect the server rate limit of 40 requests by 10 seconds, and retry
+the temporary errors (429, 503, connection lost) with an exponential backoff.
+Both can be tuned or disabled with the Limiter and Backoff fields:
+
+	client.Backoff.OnRetry = func(method string, retry int, delay time.Duration, e error) {
+		log.Println(method, "retry", retry, "in", delay, ":", e)
+	}
+
+A Session logs in with an account, and its token can be shared by many
+queries and saved between runs:
+
+	session := opensubs.NewSession(UserAgent, username, password)
+	session.SetTokenFile(filepath.Join(cacheDir, "opensubs.token"))
+	query := opensubs.NewQuerySession(session)
+
+Long running processes can keep the token alive in the background:
 
+	ka := session.KeepAlive(0, func(e error) { log.Println("keep-alive:", e) })
+	defer ka.Stop()
+
+
+Server errors are returned as *StatusError, and can be matched with the Err
+values, for example errors.Is(e, opensubs.ErrDownloadLimit) when the daily
+quota is reached. Use GetContext to get the download error.
+
+Errors of the Add methods are kept by the query and returned by Err. Files
+that can't be hashed (too small, unreadable, not a regular file) are skipped
+and the other arguments are searched. The hash can also be computed with
+HashFile, or Hash for any io.ReaderAt.
+
+Files on a HTTP server are hashed by the search without downloading them, with
+a HEAD and two Range requests. The results are referenced by the local path
+given, where the subtitles can be saved:
+
+	query.AddURL("http://nas.local/movies/Movie.mkv", "/movies/Movie.mkv", "eng")
+
+The session keeps an estimate of the download quota, from ServerInfo and the
+downloads made. Downloads that would exceed it are deferred with a *QuotaError,
+or the query can stop before downloading anything, see SetQuotaMode:
+
+	quota := session.Quota()
+	log.Println(quota.Left, "downloads left of", quota.Limit)
 
 Using downloaded data:
 First, you need to test byhash and byimdb to see if they aren't nil. There's way
 too many case of errors between the download and parsing.
+Use Download instead of Get to know which subtitles failed and why: the error
+is a *DownloadError with the list of failed subtitle IDs.
 
 byhash and byimdb are map[string]map[string][]*SubInfo
  
@@ -46,6 +118,26 @@ Gives something like this :
 
 There is always at least one SubInfo in each ref/lang slice as they are created only when filled.
 
+The same data is available with the Result returned by GetResult, without
+relying on those maps:
+
+	result, e := query.GetResult(ctx, 3)
+	sub := result.ByFile(filename).Best(lang)
+	for imdb, bylang := range result.Imdbs() {
+
+The content of a downloaded SubInfo is kept in memory, and can be used many
+times: Bytes, String, WriteTo, or Open for a new reader each time.
+
+Save writes it to a file, with options for existing files (skip, overwrite,
+keep both, backup), the file mode, and atomic writes:
+
+	path, e := sub.Save(filename, opensubs.SaveOptions{Mode: opensubs.SaveBackup, Atomic: true})
+
+SaveFor names the file next to the video with a template, or a preset for Plex,
+Jellyfin, Emby or Kodi:
+
+	path, e := sub.SaveFor(video, opensubs.NamingPlex, opensubs.SaveOptions{}) // "movie.fr.forced.srt"
+
 
 More usage informations could be found in 
  * the documentation :
@@ -56,8 +148,7 @@ Links to usefull informations about the data source:
  * http://trac.opensubtitles.org/projects/opensubtitles/wiki/XMLRPC
 
 Dependencies:
-  go get code.google.com/p/go-charset/charset
-  go get code.google.com/p/go-charset/data
+  go get golang.org/x/text/encoding
 	
 API informations:
  * Consider the search API unstable yet, but it's only 4 functions, so it shouldn't hurt too much.
@@ -69,6 +160,7 @@ package opensubs
 import (
 	xmlrpc "github.com/sqp/go-xmlrpc"
 
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
@@ -77,14 +169,13 @@ import (
 	"term"
 	"log"
 
-	"os"
 	"io"
+	"io/fs"
+	"net/url"
 	"bytes"
 	"compress/gzip"
 	"encoding/base64"
 
-	"encoding/binary"
-
 	//~ "code.google.com/p/go-charset/charset"
 	//~ _ "code.google.com/p/go-charset/data"
 )
@@ -103,30 +194,80 @@ const OPENSUBTITLE_DOMAIN = "http://api.opensubtitles.org/xml-rpc"
 
 // SubInfo contains informations about downloadable/downloaded subtitles.
 //
-// More fields can be added easily. They will be parsed directly from website.
-// Just uncomment an unused field or add the one you need and it will just be
-// matched like the others.
-// Just make sure you leave the reader as last field as it is specifically dropped.
+// Fields are the raw strings sent by the server for the SearchSubtitles
+// method. Typed accessors parse the most useful ones: Downloads, AddDate,
+// Rating, FPS, Season, Episode, HearingImpaired...
+//
+// The full response map is also kept in Raw, for values not mapped here
+// (like QueryParameters).
 //
 type SubInfo struct {
-	MatchedBy         string
-	MovieHash         string
-	IDSubtitleFile    string
-	SubLanguageID     string
-	SubFormat         string
-	//~ SubAuthorComment  string
-	//~ SubHash           string
-	//~ IDSubtitle        string
-	SubAddDate        string
-	//~ SubRating         string
-	SubDownloadsCnt   string
-	IDMovieImdb       string
-	UserNickName      string
-	UserRank          string
-	//~ SubDownloadLink   string
-	//~ ZipDownloadLink   string
-	//~ SubtitlesLink     string
-	reader            io.Reader
+	MatchedBy           string
+	IDSubMovieFile      string
+	MovieHash           string
+	MovieByteSize       string
+	MovieTimeMS         string
+	IDSubtitleFile      string
+	SubFileName         string
+	SubActualCD         string
+	SubSize             string
+	SubHash             string
+	SubLastTS           string
+	SubTSGroup          string
+	SubTSGroupHash      string
+	InfoReleaseGroup    string
+	InfoFormat          string
+	InfoOther           string
+	IDSubtitle          string
+	UserID              string
+	SubLanguageID       string
+	SubFormat           string
+	SubSumCD            string
+	SubAuthorComment    string
+	SubAddDate          string
+	SubBad              string
+	SubRating           string
+	SubSumVotes         string
+	SubDownloadsCnt     string
+	MovieReleaseName    string
+	MovieFPS            string
+	IDMovie             string
+	IDMovieImdb         string
+	MovieName           string
+	MovieNameEng        string
+	MovieYear           string
+	MovieImdbRating     string
+	MovieKind           string
+	SubFeatured         string
+	UserNickName        string
+	UserRank            string
+	SubTranslator       string
+	ISO639              string
+	LanguageName        string
+	SubComments         string
+	SubHearingImpaired  string
+	SubHD               string
+	SubEncoding         string
+	SubAutoTranslation  string
+	SubForeignPartsOnly string
+	SubFromTrusted      string
+	SeriesSeason        string
+	SeriesEpisode       string
+	SeriesIMDBParent    string
+	SubDownloadLink     string
+	ZipDownloadLink     string
+	SubtitlesLink       string
+	QueryNumber         string
+	Score               string
+
+	Raw      map[string]interface{} // Full server data for this subtitle.
+	Step     Step                   // Resolver step that found the subtitle.
+	Scoring  Score                  // Score computed to select the subtitle.
+	Encoding string                 // Encoding detected in the downloaded file, converted to UTF-8.
+
+	ref     string // Search reference for tag, fulltext and episode matches.
+	episode bool   // Matched by an episode search.
+	content []byte // Downloaded file, in UTF-8. nil if not downloaded.
 }
 
 func (sub SubInfo) Id() int {
@@ -138,12 +279,47 @@ func (sub SubInfo) ByHash() bool {
 	return sub.MatchedBy == "moviehash"
 }
 
+// Downloaded returns true if the subtitle file was downloaded.
+func (sub SubInfo) Downloaded() bool {
+	return sub.content != nil
+}
+
+// Reader returns a new reader of the downloaded file, or nil.
+// The content can be read again with other readers.
 func (sub SubInfo) Reader() io.Reader {
-	return sub.reader
+	if sub.content == nil {
+		return nil
+	}
+	return sub.Open()
+}
+
+// Open returns a new reader of the downloaded file, from the start.
+// It's empty if the file wasn't downloaded.
+func (sub SubInfo) Open() *bytes.Reader {
+	return bytes.NewReader(sub.content)
+}
+
+// Bytes returns the downloaded file. It's shared by all the readers and
+// must not be modified.
+func (sub SubInfo) Bytes() []byte {
+	return sub.content
+}
+
+// String returns the downloaded file as text.
+func (sub SubInfo) String() string {
+	return string(sub.content)
+}
+
+// WriteTo writes the downloaded file to w.
+func (sub SubInfo) WriteTo(w io.Writer) (int64, error) {
+	return sub.Open().WriteTo(w)
 }
 
+// ToFile writes the downloaded file. It fails if the file exists, see Save
+// for other options, and SaveFor to name it for a media server.
 func (sub SubInfo) ToFile(filename string) error {
-	return saveFile(filename, sub.Reader())
+	_, e := sub.Save(filename, SaveOptions{})
+	return e
 }
 
 
@@ -153,7 +329,7 @@ type subIndex map[string]*SubInfo
 
 
 // The list of available subs matched for one language of current reference.
-// Can be sorted. Current sort method is byDownloads. More could be added easily.
+// Can be sorted by a Scorer, or byDownloads without scorer.
 type subsList []*SubInfo
 
 func (s subsList) Len() int      { return len(s) }
@@ -163,9 +339,7 @@ func (s subsList) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
 type byDownloads struct{ subsList }
 
 func (s byDownloads) Less(i, j int) bool {
-	vi, _ := strconv.Atoi(s.subsList[i].SubDownloadsCnt)
-	vj, _ := strconv.Atoi(s.subsList[j].SubDownloadsCnt)
-	return vi > vj
+	return s.subsList[i].Downloads() > s.subsList[j].Downloads()
 }
 
 
@@ -191,177 +365,337 @@ func (byref subByRef) addSub(sub *SubInfo, key string) {
 //-----------------------------------------------------------------------
 
 type Query struct {
-	listArgs   []interface{}
-	byhash     subByRef
-	byimdb     subByRef
-	hashs      map[string]string // Index to rematch subs with files.
-	userAgent  string
-	token      string
+	listArgs    []interface{}
+	byhash      subByRef
+	byimdb      subByRef
+	bytag       subByRef
+	bytext      subByRef
+	byepisode   subByRef
+	hashs       map[string]string // Index to rematch subs with files.
+	urls        []remoteFile      // Hashed by the search.
+	scorer      Scorer
+	filter      Filter
+	policy      *Policy
+	concurrency int // Batch requests sent at once.
+	quotaMode   QuotaMode
+	errs        []error // Errors of the Add methods.
+	session     *Session
+	ownSession  bool // Session created by the query, closed on Logout.
 }
 
+// Create a query with its own anonymous session.
 func NewQuery(userAgent string) *Query {
 	log.SetPrefix(term.Yellow("[OpenSubs] "))
 	return &Query{
 		hashs:      make(map[string]string),
-		userAgent:  userAgent,
+		scorer:     NewScorer(),
+		session:    NewSession(userAgent, "", ""),
+		ownSession: true,
 		}
 }
 
+// Create a query using a shared session. Its token is reused, and the
+// session stays open on Logout.
+func NewQuerySession(session *Session) *Query {
+	log.SetPrefix(term.Yellow("[OpenSubs] "))
+	return &Query{
+		hashs:      make(map[string]string),
+		scorer:     NewScorer(),
+		session:    session,
+		}
+}
+
+// Use a custom client to reach the server (endpoint, HTTP transport, proxy).
+// Must be set before the Search. (Chainable)
+//
+// Queries sharing a session (NewQuerySession) use the client of the session:
+// set it with Session.SetClient. The query reports an error with Err.
+func (q *Query) SetClient(client *Client) *Query {
+	if !q.ownSession {
+		q.errs = append(q.errs, errors.New("opensubs: SetClient on a shared session, use Session.SetClient"))
+		return q
+	}
+	q.session.SetClient(client)
+	return q
+}
+
+// Set the scorer used to select the best subtitles. The default is NewScorer.
+// A nil scorer selects the most downloaded. (Chainable)
+func (q *Query) SetScorer(scorer Scorer) *Query {
+	q.scorer = scorer
+	return q
+}
+
+// Set the filter of unwanted subtitles. They are dropped before the selection
+// and never downloaded. (Chainable)
+func (q *Query) SetFilter(filter Filter) *Query {
+	q.filter = filter
+	return q
+}
+
+// Set the selection policy: the number of subtitles by language and the
+// language preferences. It replaces the n argument of Get. Unknown policy
+// languages are reported by Err. (Chainable)
+func (q *Query) SetPolicy(policy *Policy) *Query {
+	q.policy = policy
+	if e := policy.Err(); e != nil {
+		q.errs = append(q.errs, e)
+	}
+	return q
+}
+
 // Chainable
 func (q *Query) AddImdb(imdb, langs string) *Query {
-	q.listArgs = append(q.listArgs, map[string]string{"sublanguageid": langs, "imdbid": imdb})
+	q.addArg(langs, map[string]string{"imdbid": imdb})
 	return q
 }
 
 
+// Add a new search by full text, for example a movie title. (Chainable)
+//
+// Results are matched as "fulltext" and grouped by the query text.
+//
+func (q *Query) AddQuery(text, langs string) *Query {
+	q.addArg(langs, map[string]string{"query": text})
+	return q
+}
+
+// Add a new search by release name, like "The.Movie.2012.720p.BluRay.x264-GRP".
+// (Chainable)
+//
+// Results are matched as "tag" and grouped by the release name.
+//
+func (q *Query) AddTag(releaseName, langs string) *Query {
+	q.addArg(langs, map[string]string{"tag": releaseName})
+	return q
+}
+
+
+// Add a new search for a TV series episode by the series imdb id. (Chainable)
+//
+// Results are grouped by episode, see EpisodeRef.
+//
+func (q *Query) AddEpisode(imdb string, season, episode int, langs string) *Query {
+	q.addArg(langs, map[string]string{"imdbid": imdb,
+		"season": strconv.Itoa(season), "episode": strconv.Itoa(episode)})
+	return q
+}
+
+// Add a new search for a TV series episode by the series name. (Chainable)
+//
+// Results are grouped by episode, see EpisodeRef.
+//
+func (q *Query) AddEpisodeQuery(text string, season, episode int, langs string) *Query {
+	q.addArg(langs, map[string]string{"query": text,
+		"season": strconv.Itoa(season), "episode": strconv.Itoa(episode)})
+	return q
+}
+
+// EpisodeRef returns the reference used to group episode results: the series
+// imdb id or query text, followed by the season and episode, as in
+// "0903747 S01E02".
+//
+func EpisodeRef(series string, season, episode int) string {
+	return fmt.Sprintf("%s S%02dE%02d", series, season, episode)
+}
+
+
 // Add a new search by moviehash. (Chainable)
 //
 //   filename  string                The file we need to match.
 //   langs     string                The subtitles languages to find.
 //
+// Files that can't be hashed (missing, too small, not a regular file) are
+// reported by Err as *fs.PathError, and skipped by the search.
+//
 func (q *Query) AddFile(filename, langs string) *Query {
-//~ log.Println("file", filename)
-		if hash, e := moviehash(filename); e == nil {
-			stat, _ := os.Stat(filename)
-			size := fmt.Sprint(stat.Size())
-			q.listArgs = append(q.listArgs, map[string]string{"sublanguageid": langs, "moviehash": hash, "moviebytesize": size})
-			q.hashs[hash] = filename // Index filename on hash
-		}
-	
-	return q
+	hash, size, e := HashFile(filename)
+	if e != nil {
+		q.errs = append(q.errs, e)
+		return q
+	}
+	return q.AddHash(hash, size, filename, langs)
 }
 
-
-func (q *Query) Search() error {
-	return q.search()
+// Add a new search by moviehash of a file on a HTTP server, hashed with
+// HashURL. The server must support Range requests. (Chainable)
+//
+//   rawURL     string                The remote file we need to match.
+//   localPath  string                Reference of the results, where the subtitles will be saved. Empty to use the URL.
+//   langs      string                The subtitles languages to find.
+//
+// The file is hashed by the search, with its context and at most
+// URLHashTimeout for each file, with the HTTPClient of the query client (see
+// SetClient). Files that can't be hashed are then reported by Err as
+// *url.Error, and skipped.
+//
+func (q *Query) AddURL(rawURL, localPath, langs string) *Query {
+	if localPath == "" {
+		localPath = rawURL
+	}
+	q.urls = append(q.urls, remoteFile{url: rawURL, path: localPath, langs: langs})
+	return q
 }
 
+// Add a new search by a moviehash already computed, see Hash. The results
+// are referenced by filename. (Chainable)
+//
+func (q *Query) AddHash(hash string, size int64, filename, langs string) *Query {
+	if q.addArg(langs, map[string]string{"moviehash": hash, "moviebytesize": strconv.FormatInt(size, 10)}) {
+		q.hashs[hash] = filename // Index filename on hash
+	}
+	return q
+}
 
-func (q *Query) Get(n int) (subByRef, subByRef) {
-	var dl []string
-	needed := make(subIndex)
 
-	// Parsing list byhash. Need one file
-	for _ , bylang := range q.byhash { // For each movie
-		for _, list := range bylang { // For each lang
-			if len(list) > 1 {warn("multiple ref for hash matched")}
-			sort.Sort(byDownloads{list})
-			sub := list[0]
-			needed[sub.IDSubtitleFile] = sub
-			dl = append(dl, sub.IDSubtitleFile)
+// Add a search argument, with the languages converted to server codes.
+// Unknown languages are reported by Err, and the argument is dropped if no
+// language is left.
+func (q *Query) addArg(langs string, arg map[string]string) bool {
+	ids, e := DefaultLanguages.Normalize(langs)
+	if e != nil {
+		q.errs = append(q.errs, e)
+		if ids == "" {
+			return false
 		}
 	}
+	arg["sublanguageid"] = ids
+	q.listArgs = append(q.listArgs, arg)
+	return true
+}
 
-//~ printSubByRef("Matched by Hash", q.byhash)
+// Err returns the errors of the Add methods, like unknown languages, or nil.
+// Search fails with this error, unless only files or URLs failed: the other
+// arguments are still searched.
+func (q *Query) Err() error {
+	return errors.Join(q.errs...)
+}
 
-	// Parsing list byimdb to get multiple files.
-	for imdb, bylang := range q.byimdb { // For each movie
-		for _, list := range bylang { // For each lang
-			
-			sort.Sort(byDownloads{list})
-			count := 0
-			
-			log.Println(term.Magenta("Movie found"), "  imdb:", imdb) //strconv.Itoa(imdb))
-	
-			for _, sub := range list { // each sub
-				if n == -1 || count < n { // Unlimited or within limit: add to list.
-					needed[sub.IDSubtitleFile] = sub
-					dl = append(dl, sub.IDSubtitleFile)
-					log.Println(term.Green(sub.SubLanguageID), sub.SubAddDate[:10], term.Yellow(sub.SubDownloadsCnt), sub.UserNickName, term.Bracket(sub.UserRank))
-	
-					//~ break
-	
-				} else {
-					log.Println(term.Magenta(sub.SubLanguageID), sub.SubAddDate, sub.UserNickName, term.Bracket(sub.UserRank), term.Yellow(sub.SubDownloadsCnt))
-				}
-				count++
-			}
+// Returns Err if an argument error should stop the search.
+func (q *Query) argErr() error {
+	for _, e := range q.errs {
+		var pathErr *fs.PathError
+		var urlErr *url.Error
+		if !errors.As(e, &pathErr) && !errors.As(e, &urlErr) {
+			return q.Err()
 		}
 	}
-	return q.download(dl, needed)
+	return nil
 }
 
 
-// Close the token on the server.
-func (q *Query) Logout() {
-	call("LogOut", q.token)
+func (q *Query) Search() error {
+	return q.search(context.Background())
 }
 
+// Search with a context. The connection and search requests are aborted
+// if the context is cancelled or its deadline exceeded.
+func (q *Query) SearchContext(ctx context.Context) error {
+	return q.search(ctx)
+}
 
-//-----------------------------------------------------------------------
-// Server query.
-//-----------------------------------------------------------------------
 
-// Process a xmlrpc call on OpenSubtitles.org server.
-func call(name string, args ...interface{}) (xmlrpc.Struct, error) {
-	res, e := xmlrpc.Call(OPENSUBTITLE_DOMAIN, name, args...)
-	if e == nil {
-		if data, ok := res.(xmlrpc.Struct); ok {
-			return data, e
-		}
-	}
-	return nil, e
+func (q *Query) Get(n int) (subByRef, subByRef) {
+	byhash, byimdb, _ := q.GetContext(context.Background(), n)
+	return byhash, byimdb
 }
 
-// Initiate connection to OpenSubtitles.org to get a valid token.
-func (q *Query) connect() error {
-	res, e := call("LogIn", "", "", "en", q.userAgent)
-	switch {
-	case e != nil:
-		return e
-	case res == nil || len(res) == 0:
-		return errors.New("connection problem")
-	}
-
-	if token, ok := res["token"].(string); ok {
-		q.token = token
-		return nil
-	}
-	return errors.New("OpenSubtitles Token problem")
+// Get, with the error. The results are those correctly downloaded, and the
+// error is a *DownloadError listing the failed subtitles if only some of them
+// failed.
+func (q *Query) Download(n int) (subByRef, subByRef, error) {
+	return q.GetContext(context.Background(), n)
 }
 
+// Get with a context. Download requests are aborted if the context is
+// cancelled or its deadline exceeded: the subtitles not downloaded are listed
+// in the *DownloadError with the context error, matched by errors.Is.
+func (q *Query) GetContext(ctx context.Context, n int) (subByRef, subByRef, error) {
+	res, e := q.get(ctx, n)
+	return res.byhash, res.byimdb, e
+}
 
-func (q *Query) search() error {
-	e := q.connect()
-	switch {
-	case e != nil:
-		return e
-	case q.token == "":
-		return errors.New("invalid token")
+// Select and download subtitles.
+func (q *Query) get(ctx context.Context, n int) (*Result, error) {
+	policy := q.policy
+	if policy == nil {
+		policy = NewPolicy(n)
 	}
+	var dl []string
+	needed := make(subIndex)
 
-	searchData, e := call("SearchSubtitles", q.token, q.listArgs)
-	if e != nil {
-		return e
-	}
-	for k, v := range searchData {
-		if k == "data" {
-			if array, ok := v.(xmlrpc.Array); ok {
-				q.byhash, q.byimdb = mapSubInfos(array)
+	// Parsing list byhash. Need one file
+	for hash, bylang := range q.byhash { // For each movie
+		for _, lang := range policy.order(bylang) { // For each lang
+			list := filterSubs(bylang[lang], q.filter)
+			if len(list) == 0 {
+				continue
+			}
+			if len(list) > 1 {warn("multiple ref for hash matched")}
+			sortByScore(list, q.scorer, q.hashs[hash])
+			sub := list[0]
+			needed[sub.IDSubtitleFile] = sub
+			dl = append(dl, sub.IDSubtitleFile)
+			if policy.StopAtHash || policy.FirstOnly {
+				break
 			}
 		}
 	}
-	
-	return nil
-}
-
 
+//~ printSubByRef("Matched by Hash", q.byhash)
 
-//~ func download(ids []string) (xmlrpc.Struct, error) {
-func (q *Query) download(ids []string, needed subIndex) (subByRef, subByRef) {
-	if len(ids) == 0 {
-		return nil, nil
-	}
-	if s, e := call("DownloadSubtitles", q.token, ids); e == nil {
-		for k, v := range s {
-			if k == "data" {
-				if array, ok := v.(xmlrpc.Array); ok { // Found valid data array.
-					return q.parseSubFiles(array, needed)
+	// Parsing lists byepisode, byimdb, bytag and bytext to get multiple files.
+	for _, byref := range []subByRef{q.byepisode, q.byimdb, q.bytag, q.bytext} {
+		for ref, bylang := range byref { // For each movie
+			for _, lang := range policy.order(bylang) { // For each lang
+				list := filterSubs(bylang[lang], q.filter)
+				if len(list) == 0 {
+					continue
+				}
+				sortByScore(list, q.scorer, list[0].ref) // No ref for imdb matches.
+				count := 0
+				limit := policy.count(lang)
+				
+				log.Println(term.Magenta("Movie found"), "  ref:", ref)
+		
+				for _, sub := range list { // each sub
+					if _, ok := needed[sub.IDSubtitleFile]; ok { // Already downloaded for another match.
+						continue
+					}
+					if limit == -1 || count < limit { // Unlimited or within limit: add to list.
+						needed[sub.IDSubtitleFile] = sub
+						dl = append(dl, sub.IDSubtitleFile)
+						log.Println(term.Green(sub.SubLanguageID), sub.AddDate().Format("2006-01-02"), term.Yellow(sub.SubDownloadsCnt), sub.UserNickName, term.Bracket(sub.UserRank))
+		
+						//~ break
+		
+					} else {
+						log.Println(term.Magenta(sub.SubLanguageID), sub.SubAddDate, sub.UserNickName, term.Bracket(sub.UserRank), term.Yellow(sub.SubDownloadsCnt))
+					}
+					count++
+				}
+				if policy.FirstOnly && count > 0 && limit != 0 { // Something was selected for this lang.
+					break
 				}
 			}
 		}
 	}
-	return nil, nil
+	return q.download(ctx, dl, needed)
+}
+
+
+// Close the token on the server.
+func (q *Query) Logout() error {
+	return q.LogoutContext(context.Background())
+}
+
+// Close the token on the server, with a context.
+// A shared session is left open, see Session.Logout.
+func (q *Query) LogoutContext(ctx context.Context) error {
+	if !q.ownSession {
+		return nil
+	}
+	return q.session.Logout(ctx)
 }
 
 
@@ -377,7 +711,10 @@ func (q *Query) PrintArgs() {
 
 func (q *Query) PrintSubInfos() {
 	printSubByRef("Matched by Hash", q.byhash)
+	printSubByRef("Matched by episode", q.byepisode)
 	printSubByRef("Matched by IMDB", q.byimdb)
+	printSubByRef("Matched by tag", q.bytag)
+	printSubByRef("Matched by text", q.bytext)
 }
 
 
@@ -391,7 +728,7 @@ func printSubByRef(title string, byref subByRef) {
 		for lang, list := range bylang {
 		fmt.Println(" ", term.Yellow(lang))
 			for index, sub := range list {
-				fmt.Println(" ", term.FgGreen, index, term.Reset, sub.SubAddDate[:10], term.Yellow(sub.SubDownloadsCnt), sub.UserNickName, term.Bracket(sub.UserRank))
+				fmt.Println(" ", term.FgGreen, index, term.Reset, sub.AddDate().Format("2006-01-02"), term.Yellow(sub.SubDownloadsCnt), sub.UserNickName, term.Bracket(sub.UserRank))
 				//~ fmt.Printf(" ", " ", "#%d : %# v\n", index,sub)
 			}
 		}
@@ -402,12 +739,13 @@ func printSubByRef(title string, byref subByRef) {
 // Parse downloaded files.
 //-----------------------------------------------------------------------
 
-func (q *Query) parseSubFiles(array xmlrpc.Array, needed subIndex) (subByRef, subByRef) {
-	byhash := make(subByRef)
-	byimdb := make(subByRef)
+func (q *Query) parseSubFiles(array xmlrpc.Array, needed subIndex) (*Result, error) {
+	res := newResult()
+	dlerr := &DownloadError{}
+	received := make(map[string]bool)
 
 	var subid, subtext string
-	var gz []byte
+	var gz, raw, text []byte
 	var e error
 	var reader io.Reader
 	var sub *SubInfo
@@ -415,65 +753,89 @@ func (q *Query) parseSubFiles(array xmlrpc.Array, needed subIndex) (subByRef, su
 	for _, fi := range array {
 		data, ok := fi.(xmlrpc.Struct); 
 		if !ok {
+			dlerr.add("", errors.New("invalid file data"))
 			continue
 		}
 		subid, ok = data["idsubtitlefile"].(string)
 		if !ok {
+			dlerr.add("", errors.New("missing idsubtitlefile"))
 			continue
 		}
+		received[subid] = true
 
 		subtext, ok = data["data"].(string)
 		if !ok {
+			dlerr.add(subid, errors.New("missing data"))
 			continue
 		}
 		
 		/// Get matching SubInfo
 		sub, ok = needed[subid]
 		if !ok {
+			dlerr.add(subid, errors.New("not requested"))
 			continue
 		}
 
 		/// unbase64
 		gz, e = base64.StdEncoding.DecodeString(subtext)
-		if e != nil || len(gz) == 0 {
-			warn("base64", e)
+		if e == nil && len(gz) == 0 {
+			e = errors.New("empty data")
+		}
+		if e != nil {
+			dlerr.add(subid, fmt.Errorf("base64: %w", e))
 			continue
 		}
 		reader = bytes.NewBuffer(gz)
 
 		/// gunzip
 		reader, e =	gzip.NewReader(reader)
+		if e == nil {
+			raw, e = io.ReadAll(reader)
+		}
 		if e != nil {
-			warn("gunzip", e)
+			dlerr.add(subid, fmt.Errorf("gunzip: %w", e))
 			continue
 		}
 
-		/// Convert to UTF-8 and save reader.
-		//~ reader, e = charset.NewReader("latin1", reader)
-		//~ if e != nil {
-			//~ warn("utf8", e)
-			//~ continue
-		//~ }
-		sub.reader = reader
+		/// Convert to UTF-8 and save content.
+		text, sub.Encoding = toUTF8(raw, sub.SubEncoding, sub.SubLanguageID)
+		sub.content = append([]byte{}, text...) // Never nil once downloaded.
 		if sub.SubFormat != "srt" {
 			warn("sub format", sub.SubFormat)
 		}
 		
 		/// Everything was OK: add the reference to result.
-		switch sub.MatchedBy {
-		case "moviehash":
+		switch {
+		case sub.episode:
+			res.byepisode.addSub(sub, sub.ref)
+		case sub.MatchedBy == "moviehash":
 		//~ log.Println("got fucking file", sub.MovieHash, q.hashs[sub.MovieHash])
-			byhash.addSub(sub, q.hashs[sub.MovieHash])
-		case "imdbid":
-			byimdb.addSub(sub, sub.IDMovieImdb)
+			res.byhash.addSub(sub, q.hashs[sub.MovieHash])
+		case sub.MatchedBy == "imdbid":
+			res.byimdb.addSub(sub, sub.IDMovieImdb)
+		case sub.MatchedBy == "tag":
+			res.bytag.addSub(sub, sub.ref)
+		case sub.MatchedBy == "fulltext":
+			res.bytext.addSub(sub, sub.ref)
 		}
 	}
-if len(byhash) > 0 {
-		log.Println("Found downloaded by hash : ", len(byhash))
+if len(res.byhash) > 0 {
+		log.Println("Found downloaded by hash : ", len(res.byhash))
 	}
 
+	/// Requested files the server didn't send.
+	var missing []string
+	for subid := range needed {
+		if !received[subid] {
+			missing = append(missing, subid)
+		}
+	}
+	sort.Strings(missing)
+	for _, subid := range missing {
+		dlerr.add(subid, ErrNotReturned)
+	}
 
-	return byhash, byimdb
+	return res, dlerr.err()
 }
 
 
@@ -481,24 +843,37 @@ if len(byhash) > 0 {
 // Parse downloaded SubInfo.
 //-----------------------------------------------------------------------
 
-func mapSubInfos(data []interface{}) (subByRef, subByRef) {
+func (q *Query) mapSubInfos(data []interface{}) {
 	byhash := make(subByRef)
 	byimdb := make(subByRef)
+	bytag := make(subByRef)
+	bytext := make(subByRef)
+	byepisode := make(subByRef)
 	
 	hashImdbIndex := make(subIndex)
-	var matchedImdb subsList
+	var matchedImdb, matchedEpisodes subsList
 	for _, value := range data { // Array of data
 		if vMap, ok := value.(xmlrpc.Struct); ok {
 
 			sub := mapOneSub(vMap)
+			if sub.MatchedBy != "moviehash" && q.argRef(sub, "season", "") != "" { // Episode search.
+				sub.episode = true
+				sub.ref = q.episodeRef(sub)
+				matchedEpisodes = append(matchedEpisodes, sub)
+				continue
+			}
 			switch sub.MatchedBy {
 			case "moviehash":
 				byhash.addSub(sub, sub.MovieHash)
 				hashImdbIndex[sub.IDMovieImdb] = sub // saving reference for 2nd pass
 			case "imdbid":
 				matchedImdb = append(matchedImdb, sub)
-			//~ case "tag":
-			//~ case "fulltext":
+			case "tag":
+				sub.ref = q.argRef(sub, "tag", sub.MovieReleaseName)
+				bytag.addSub(sub, sub.ref)
+			case "fulltext":
+				sub.ref = q.argRef(sub, "query", sub.MovieName)
+				bytext.addSub(sub, sub.ref)
 			default:
 				warn("match failed. not implemented", sub.MatchedBy)
 			}
@@ -514,158 +889,59 @@ func mapSubInfos(data []interface{}) (subByRef, subByRef) {
 
 			
 	}
-	return byhash, byimdb
-}
-
-
-func mapOneSub(parseMap map[string]interface{}) *SubInfo {
-	typ := reflect.TypeOf(SubInfo{})
-	n := typ.NumField()
-
-	item := &SubInfo{}
-	elem := reflect.ValueOf(item).Elem()
-
-	for i := 0; i < n - 1; i++ { // Parsing all fields in type except last one. reader is a private member.
-		field := typ.Field(i)
-		if v, ok := parseMap[field.Name]; ok { // Got matching row in map
-			if elem.Field(i).Kind() == reflect.TypeOf(v).Kind() { // Types are compatible.
-				elem.Field(i).Set(reflect.ValueOf(v))
-			} else {
-				warn("XML Import Field mismatch", field.Name, elem.Field(i).Kind(), reflect.TypeOf(v).Kind())
-			}
+	for _, sub := range matchedEpisodes {
+		if _, ok := hashImdbIndex[sub.IDMovieImdb]; !ok { // Same for episodes.
+			byepisode.addSub(sub, sub.ref)
 		}
 	}
-	return item
+	q.byhash, q.byimdb, q.bytag, q.bytext, q.byepisode = byhash, byimdb, bytag, bytext, byepisode
 }
 
-
-//-----------------------------------------------------------------------
-// Common
-//-----------------------------------------------------------------------
-
-func saveFile(filename string, reader io.Reader) error {
-	if _, e := os.Stat(filename); e == nil {
-		warn("File exists ", filename)
-		return errors.New("file exists")
-	}
-
-	writer, err := os.Create(filename)
-	if err != nil {
-		warn("Can't save ", filename, err)
-		return err
+// Get the episode reference of a sub matched by an episode search.
+// The season and episode sent by the server are preferred to those asked.
+func (q *Query) episodeRef(sub *SubInfo) string {
+	series := q.argRef(sub, "imdbid", q.argRef(sub, "query", sub.SeriesIMDBParent))
+	season, episode := sub.Season(), sub.Episode()
+	if season == 0 && episode == 0 {
+		season, episode = atoi(q.argRef(sub, "season", "")), atoi(q.argRef(sub, "episode", ""))
 	}
-	warn("Write File", filename)
-	defer writer.Close()
-	io.Copy(writer, reader)
-	return nil
+	return EpisodeRef(series, season, episode)
 }
 
-
-//~ import (
-	//~ "os"
-	//~ "encoding/binary"
-	//~ "strconv"
-	//~ "flag"
-//~ )
-
-const hashBlocks = 8192
-
-func moviehash(filename string) (string, error) {
- //~ /*
-  //~ * Public Domain implementation by SQP. 
-  //~ * Simply converted to Golang the C version by Kamil Dziobek.
-  //~ * This code implements Gibest hash algorithm first use in Media Player Classics
-  //~ * For more implementation(various languages and authors) see:
-  //~ * http://trac.opensubtitles.org/projects/opensubtitles/wiki/HashSourceCodes   
-  //~ */
-	file, e1 := os.Open(filename) // Try to open file.
-	if e1 != nil {
-		return "", e1
-	}
-	
-	stat, e2 := file.Stat() // File must have stat to get size.
-	if e2 != nil {
-		return "", e2
-	}
-	hash := uint64(stat.Size()) // Add file size to hash.
-
-	buffer := make([]byte, hashBlocks * 8 * 2) // Two blocks buffer.
-  file.Read(buffer[:hashBlocks * 8]) // Read start block.
-  file.Seek(-hashBlocks * 8, 2) // Move to beginning of end block.
-	file.Read(buffer[hashBlocks * 8:]) // Read end block.
-	
-	for i:= 0; i < hashBlocks * 2; i++ { // Parse the 2 blocks buffer with 8 bytes step.
-		// Add the value of the next 8 bytes to hash.
-		hash += binary.LittleEndian.Uint64(buffer[i * 8:i * 8 + 8])
-	}
-
-	//~ fmt.Printf("new hash %x\n", hash)
-	//~ fmt.Println("test", strconv.FormatUint(hash, 16))
-	//~ out, _ := exec.Command("moviehash.php", filename).Output()
-	//~ fmt.Println("old hash", string(out))
-
-	//~ os.Stdout.Write([]byte(strconv.FormatUint(hash, 16)))
-
-	return strconv.FormatUint(hash, 16), nil // Return result in hexadecimal format.
-}
-
-//~ func main() {
-	//~ os.Stdout.Write([]byte("hash : " + moviehash(flag.Arg(0)) + "\n"))
-//~ }
-
-
-/*
-func moviehash_crappy(filename string) string {
-	file, e := os.Open(filename)
-	if e != nil {
-		return ""
-	}
-	
-	
-	stat, _ := file.Stat()
-	fsize := uint64(stat.Size())
-  hash := []uint64{fsize & 0xFFFF, (fsize >> 16) & 0xFFFF, 0, 0}
-	
-	buffer := make([]byte, 65536 * 2)
-  file.Read(buffer[:65536])
-  file.Seek(-65536, 2)
-	file.Read(buffer[65536:])
-	
-	block := make([]uint64, 4)
-	for i:= 0; i < 8192 * 2; i++ {
-		for j := 0; j < 4; j++ {
-			//~ block[j], _ = binary.Uvarint(buffer[i * 8 + j * 2:i * 8 + j * 2 + 2])
-			pos := i * 8 + j * 2
-			block[j] = uint64(buffer[pos]) + 256 * uint64(buffer[pos + 1])
-			//~ if i < 10 { fmt.Println(j, buffer[i * 8 + j * 2:i * 8 + j * 2 + 2], block[j]) }
-			//~ if i < 10 { fmt.Printf("%d %x\n", j, block[j]) }
+// Get the value of the search argument that matched the sub, or def if the
+// server didn't tell.
+func (q *Query) argRef(sub *SubInfo, key, def string) string {
+	if sub.QueryNumber != "" {
+		if i := sub.QueryIndex(); i >= 0 && i < len(q.listArgs) {
+			if arg, ok := q.listArgs[i].(map[string]string); ok && arg[key] != "" {
+				return arg[key]
+			}
 		}
-			//~ if i < 10 { fmt.Println(i, "  ", block) }
-		hash = AddUINT64(hash, block)
 	}
-
-	return fmt.Sprintf("%04x%04x%04x%04x", hash[3], hash[2], hash[1], hash[0])
+	return def
 }
 
-func AddUINT64(hash, block []uint64) []uint64 {
-	ret := make([]uint64, 4)
 
-	carry := uint64(0);
-	for i := 0; i < 4; i++ {
-		if (hash[i] + block[i] + carry) > 0xffff {
-			ret[i] += (hash[i] + block[i] + carry) & 0xffff;
-			carry = 1;
-		} else {
-			ret[i] += (hash[i] + block[i] + carry);
-			carry = 0;
+func mapOneSub(parseMap map[string]interface{}) *SubInfo {
+	item := &SubInfo{Raw: parseMap}
+	for name, field := range item.fields() {
+		switch v := parseMap[name].(type) {
+		case nil:
+		case string:
+			*field = v
+		case int, float64, bool:
+			*field = fmt.Sprint(v)
+		default:
+			warn("XML Import Field mismatch", name, reflect.TypeOf(v).Kind())
 		}
 	}
-	
-	return ret;   
+	return item
 }
-*/
 
 
+//-----------------------------------------------------------------------
+// Common
+//-----------------------------------------------------------------------
 
 func warn(source string, data... interface{}) {
 	args := []interface{}{}
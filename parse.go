@@ -0,0 +1,247 @@
+package opensubs
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//-----------------------------------------------------------------------
+// Filename parsing.
+//-----------------------------------------------------------------------
+
+// ParsedName holds the informations guessed from a release filename like
+// "Show.S02E05.720p.WEB-DL.x264-GRP.mkv" or "Movie.2012.Extended.1080p.BluRay.mkv".
+//
+// Unknown values are left empty (or 0).
+//
+type ParsedName struct {
+	Title      string // Show or movie title, with spaces: "Show".
+	Year       int    // 2012.
+	Season     int    // 2.
+	Episode    int    // 5.
+	Resolution string // "720p", "1080p", "2160p"...
+	Source     string // "BluRay", "WEB-DL", "HDTV", "DVDRip"...
+	Codec      string // "x264", "x265", "XviD"...
+	Group      string // Release group: "GRP".
+	Edition    string // "Extended", "Director's Cut", "Unrated"...
+	Part       int    // Part or CD number: 1 for "CD1".
+	Release    string // Filename without path and extension, usable as tag.
+}
+
+// IsEpisode returns true if the name was recognized as a TV episode.
+//
+func (p ParsedName) IsEpisode() bool {
+	return p.Season > 0 || p.Episode > 0
+}
+
+// Query returns the text to use for a full text search: title and year.
+//
+func (p ParsedName) Query() string {
+	if p.Year > 0 && !p.IsEpisode() {
+		return p.Title + " " + strconv.Itoa(p.Year)
+	}
+	return p.Title
+}
+
+var (
+	reEpisode    = regexp.MustCompile(`(?i)^s(\d{1,2})[ ._-]?e(\d{1,3})(?:-?e\d{1,3})*$`)
+	reEpisodeX   = regexp.MustCompile(`(?i)^(\d{1,2})x(\d{2,3})$`)
+	reSeason     = regexp.MustCompile(`(?i)^season[ ._-]?(\d{1,2})$`)
+	reYear       = regexp.MustCompile(`^(19\d{2}|20\d{2})$`)
+	reResolution = regexp.MustCompile(`(?i)^(\d{3,4}[pi]|4k|uhd)$`)
+	rePart       = regexp.MustCompile(`(?i)^(?:cd|disc|disk|part|pt)[ ._-]?(\d{1,2})$`)
+	reGroup      = regexp.MustCompile(`-([A-Za-z0-9]+)(?:\[[^\]]*\])?$`)
+	reSplit      = regexp.MustCompile(`[ ._\[\]()]+`)
+)
+
+// Known tokens, lowercase, with their display value.
+var (
+	nameSources = map[string]string{
+		"bluray": "BluRay", "blu-ray": "BluRay", "bdrip": "BDRip", "brrip": "BRRip",
+		"web-dl": "WEB-DL", "webdl": "WEB-DL", "webrip": "WEBRip", "web": "WEB",
+		"hdtv": "HDTV", "pdtv": "PDTV", "dsr": "DSR", "dvdrip": "DVDRip",
+		"dvd": "DVD", "dvdscr": "DVDSCR", "hdrip": "HDRip", "remux": "Remux",
+		"cam": "CAM", "ts": "TS", "telesync": "TS", "r5": "R5",
+	}
+	nameCodecs = map[string]string{
+		"x264": "x264", "h264": "H.264", "avc": "H.264",
+		"x265": "x265", "h265": "H.265", "hevc": "HEVC",
+		"xvid": "XviD", "divx": "DivX", "av1": "AV1", "vp9": "VP9",
+	}
+	nameEditions = map[string]string{
+		"extended": "Extended", "unrated": "Unrated", "uncut": "Uncut",
+		"remastered": "Remastered", "theatrical": "Theatrical", "imax": "IMAX",
+		"criterion": "Criterion", "dc": "Director's Cut", "directors": "Director's Cut",
+		"limited": "Limited", "special": "Special Edition",
+	}
+	nameOthers = map[string]bool{ // Tokens ending the title, without value.
+		"proper": true, "repack": true, "internal": true, "multi": true,
+		"french": true, "vostfr": true, "truefrench": true, "subbed": true,
+		"dubbed": true, "hdr": true, "10bit": true, "dts": true, "ac3": true,
+		"aac": true, "dd5": true, "atmos": true, "complete": true,
+	}
+	nameExtensions = map[string]bool{ // Media and subtitle extensions, stripped from the release.
+		".mkv": true, ".mp4": true, ".m4v": true, ".avi": true, ".mov": true,
+		".wmv": true, ".mpg": true, ".mpeg": true, ".ts": true, ".m2ts": true,
+		".webm": true, ".flv": true, ".ogm": true, ".ogv": true, ".divx": true,
+		".vob": true, ".iso": true, ".rmvb": true, ".3gp": true,
+		".srt": true, ".sub": true, ".ass": true, ".ssa": true, ".idx": true,
+	}
+)
+
+// ParseName guesses the release informations from a media filename.
+// The path and extension are ignored.
+//
+func ParseName(filename string) ParsedName {
+	base := filepath.Base(filename)
+	if ext := filepath.Ext(base); nameExtensions[strings.ToLower(ext)] {
+		base = strings.TrimSuffix(base, ext)
+	}
+	p := ParsedName{Release: base}
+
+	name := base
+	if m := reGroup.FindStringSubmatch(name); m != nil && !isGroupToken(name[:len(name)-len(m[0])], m[1]) {
+		p.Group = m[1]
+		name = name[:len(name)-len(m[0])]
+	}
+
+	tokens := reSplit.Split(name, -1)
+	titleEnd := -1 // Index of the first non title token.
+	yearIdx := -1  // Index of the last year before the other tokens: "Blade.Runner.2049.2017".
+	setEnd := func(i int) {
+		if titleEnd < 0 {
+			titleEnd = i
+		}
+	}
+
+	for i, tok := range tokens {
+		low := strings.ToLower(tok)
+		switch {
+		case tok == "":
+
+		case reEpisode.MatchString(tok):
+			m := reEpisode.FindStringSubmatch(tok)
+			p.Season, p.Episode = atoi(m[1]), atoi(m[2])
+			setEnd(i)
+
+		case reEpisodeX.MatchString(tok) && i > 0:
+			m := reEpisodeX.FindStringSubmatch(tok)
+			p.Season, p.Episode = atoi(m[1]), atoi(m[2])
+			setEnd(i)
+
+		case reSeason.MatchString(tok):
+			p.Season = atoi(reSeason.FindStringSubmatch(tok)[1])
+			setEnd(i)
+
+		case low == "season" && i+1 < len(tokens) && atoi(tokens[i+1]) > 0:
+			p.Season = atoi(tokens[i+1])
+			setEnd(i)
+
+		case reYear.MatchString(tok) && i > 0: // A title can be a year: "1917".
+			switch {
+			case titleEnd < 0: // The last one is the year, the others are in the title.
+				p.Year, yearIdx = atoi(tok), i
+			case p.Year == 0:
+				p.Year = atoi(tok)
+			}
+
+		case reResolution.MatchString(tok):
+			p.Resolution = strings.ToLower(tok)
+			setEnd(i)
+
+		case rePart.MatchString(tok):
+			p.Part = atoi(rePart.FindStringSubmatch(tok)[1])
+			setEnd(i)
+
+		case nameSources[low] != "":
+			p.Source = nameSources[low]
+			setEnd(i)
+
+		case nameCodecs[low] != "":
+			p.Codec = nameCodecs[low]
+			setEnd(i)
+
+		case nameEditions[low] != "":
+			if p.Edition == "" {
+				p.Edition = nameEditions[low]
+			}
+			if low == "directors" && i+1 < len(tokens) && strings.EqualFold(tokens[i+1], "cut") {
+				p.Edition = "Director's Cut"
+			}
+			setEnd(i)
+
+		case nameOthers[low]:
+			setEnd(i)
+		}
+	}
+
+	if yearIdx >= 0 {
+		titleEnd = yearIdx // Always before the other tokens.
+	}
+	if titleEnd < 0 {
+		titleEnd = len(tokens)
+	}
+	var title []string
+	for _, tok := range tokens[:titleEnd] {
+		if tok != "" {
+			title = append(title, tok)
+		}
+	}
+	p.Title = strings.TrimSpace(strings.Trim(strings.Join(title, " "), "-"))
+	return p
+}
+
+// The release group is a known token, or the end of one like "WEB-DL", or
+// is in a title without release tokens like "Spider-Man".
+func isGroupToken(before, group string) bool {
+	low := strings.ToLower(group)
+	if nameSources[low] != "" || nameCodecs[low] != "" || reResolution.MatchString(low) {
+		return true
+	}
+	tokens := reSplit.Split(before, -1)
+	last := strings.ToLower(tokens[len(tokens)-1])
+	if nameSources[last+"-"+low] != "" {
+		return true
+	}
+	for i, tok := range tokens {
+		if isReleaseToken(tok, i) {
+			return false
+		}
+	}
+	return true
+}
+
+// The token is a release information, ending the title.
+func isReleaseToken(tok string, i int) bool {
+	low := strings.ToLower(tok)
+	return reEpisode.MatchString(tok) || (reEpisodeX.MatchString(tok) && i > 0) ||
+		reSeason.MatchString(tok) || (reYear.MatchString(tok) && i > 0) ||
+		reResolution.MatchString(tok) || rePart.MatchString(tok) ||
+		nameSources[low] != "" || nameCodecs[low] != "" || nameEditions[low] != "" || nameOthers[low]
+}
+
+//-----------------------------------------------------------------------
+// Query builder.
+//-----------------------------------------------------------------------
+
+// Add searches guessed from the filename: an episode search for TV episodes,
+// or a full text search with the title and year. (Chainable)
+//
+// Nothing is added if no title was found.
+//
+func (q *Query) AddName(filename, langs string) *Query {
+	p := ParseName(filename)
+	switch {
+	case p.Title == "":
+		warn("no title found", filename)
+
+	case p.IsEpisode():
+		q.AddEpisodeQuery(p.Title, p.Season, p.Episode, langs)
+
+	default:
+		q.AddQuery(p.Query(), langs)
+	}
+	return q
+}
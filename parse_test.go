@@ -0,0 +1,65 @@
+package opensubs
+
+import "testing"
+
+func TestParseName(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     ParsedName
+	}{
+		{"/x/Show.S02E05.720p.WEB-DL.x264-GRP.mkv", ParsedName{
+			Title: "Show", Season: 2, Episode: 5, Resolution: "720p", Source: "WEB-DL",
+			Codec: "x264", Group: "GRP", Release: "Show.S02E05.720p.WEB-DL.x264-GRP"}},
+		{"Movie.Title.2012.Extended.1080p.BluRay.x264-SPARKS.mkv", ParsedName{
+			Title: "Movie Title", Year: 2012, Edition: "Extended", Resolution: "1080p",
+			Source: "BluRay", Codec: "x264", Group: "SPARKS",
+			Release: "Movie.Title.2012.Extended.1080p.BluRay.x264-SPARKS"}},
+		{"show.name.3x07.hdtv.xvid-lol.avi", ParsedName{
+			Title: "show name", Season: 3, Episode: 7, Source: "HDTV", Codec: "XviD",
+			Group: "lol", Release: "show.name.3x07.hdtv.xvid-lol"}},
+		{"The Movie (1999) CD1.avi", ParsedName{
+			Title: "The Movie", Year: 1999, Part: 1, Release: "The Movie (1999) CD1"}},
+		{"1917.2019.1080p.WEB-DL.mkv", ParsedName{
+			Title: "1917", Year: 2019, Resolution: "1080p", Source: "WEB-DL",
+			Release: "1917.2019.1080p.WEB-DL"}},
+		{"plainname.mp4", ParsedName{Title: "plainname", Release: "plainname"}},
+
+		// Not an extension.
+		{"The.Movie.2012", ParsedName{Title: "The Movie", Year: 2012, Release: "The.Movie.2012"}},
+
+		// Dash in the title, not a release group.
+		{"Spider-Man.mkv", ParsedName{Title: "Spider-Man", Release: "Spider-Man"}},
+		{"Spider-Man.2002.720p.BluRay.x264-GRP.mkv", ParsedName{
+			Title: "Spider-Man", Year: 2002, Resolution: "720p", Source: "BluRay",
+			Codec: "x264", Group: "GRP", Release: "Spider-Man.2002.720p.BluRay.x264-GRP"}},
+
+		// The last year is the release year.
+		{"Blade.Runner.2049.2017", ParsedName{
+			Title: "Blade Runner 2049", Year: 2017, Release: "Blade.Runner.2049.2017"}},
+		{"Blade.Runner.2049.2017.1080p.mkv", ParsedName{
+			Title: "Blade Runner 2049", Year: 2017, Resolution: "1080p",
+			Release: "Blade.Runner.2049.2017.1080p"}},
+	}
+
+	for _, tt := range tests {
+		if got := ParseName(tt.filename); got != tt.want {
+			t.Errorf("ParseName(%q)\n got %+v\nwant %+v", tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestParsedNameQuery(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"Movie.Title.2012.1080p.mkv", "Movie Title 2012"},
+		{"Show.S02E05.720p.mkv", "Show"},
+		{"plainname.mp4", "plainname"},
+	}
+	for _, tt := range tests {
+		if got := ParseName(tt.filename).Query(); got != tt.want {
+			t.Errorf("ParseName(%q).Query() = %q, want %q", tt.filename, got, tt.want)
+		}
+	}
+}
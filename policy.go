@@ -0,0 +1,156 @@
+package opensubs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//-----------------------------------------------------------------------
+// Selection policy.
+//-----------------------------------------------------------------------
+
+// Policy selects how many subtitles are downloaded for each language.
+//
+// Hash matches fit the file, so only the best one is downloaded for each
+// language. Counts apply to imdb, episode, tag and full text matches.
+//
+//	// 2 subtitles in english, 1 in french.
+//	policy := opensubs.NewPolicy(1).SetCount("eng", 2)
+//
+//	// Only the first available language: english, else french, else spanish.
+//	policy := opensubs.NewPolicy(1).SetLanguages("eng", "fre", "spa")
+//	policy.FirstOnly = true
+//
+type Policy struct {
+	Count      int            // Subtitles by language. -1 for unlimited.
+	Counts     map[string]int // Count by language, replacing Count.
+	Languages  []string       // Languages by preference. The others come after.
+	FirstOnly  bool           // Only download the first language with subtitles, for each reference.
+	StopAtHash bool           // Only download the first language with a hash match, for each file.
+
+	errs []error // Unknown languages.
+}
+
+// NewPolicy creates a policy downloading n subtitles by language.
+//
+func NewPolicy(n int) *Policy {
+	return &Policy{Count: n, Counts: make(map[string]int)}
+}
+
+// Set the number of subtitles to download for the language. Languages are
+// codes or names, as for the Query: "en", "fr-FR", "French". (Chainable)
+//
+func (p *Policy) SetCount(lang string, n int) *Policy {
+	if p.Counts == nil {
+		p.Counts = make(map[string]int)
+	}
+	p.Counts[p.lang(lang)] = n
+	return p
+}
+
+// Set the languages by preference. (Chainable)
+//
+func (p *Policy) SetLanguages(langs ...string) *Policy {
+	p.Languages = make([]string, len(langs))
+	for i, lang := range langs {
+		p.Languages[i] = p.lang(lang)
+	}
+	return p
+}
+
+// Err returns the unknown languages given to SetCount and SetLanguages, or
+// nil. A Query with this policy fails to search.
+//
+func (p *Policy) Err() error {
+	if p == nil {
+		return nil
+	}
+	return errors.Join(p.errs...)
+}
+
+// Convert the language to its server code. Unknown languages are reported by
+// Err, and kept in lower case.
+func (p *Policy) lang(name string) string {
+	lang, ok := DefaultLanguages.Lookup(name)
+	if !ok {
+		p.errs = append(p.errs, fmt.Errorf("policy: %w: %s", ErrUnknownLanguage, name))
+		return strings.ToLower(strings.TrimSpace(name))
+	}
+	return lang.ID
+}
+
+// Number of subtitles to download for the language. -1 for unlimited.
+func (p *Policy) count(lang string) int {
+	if n, ok := p.Counts[lang]; ok {
+		return n
+	}
+	return p.Count
+}
+
+// List the languages found, by preference.
+func (p *Policy) order(bylang subByLang) []string {
+	var langs, others []string
+	preferred := make(map[string]bool)
+	for _, lang := range p.Languages {
+		if _, ok := bylang[lang]; ok && !preferred[lang] {
+			langs = append(langs, lang)
+		}
+		preferred[lang] = true
+	}
+	for lang := range bylang {
+		if !preferred[lang] {
+			others = append(others, lang)
+		}
+	}
+	sort.Strings(others)
+	return append(langs, others...)
+}
+
+// ParsePolicy creates a policy from a text description, for command line
+// options. Terms are separated by comma. Languages are listed by preference,
+// with an optional count, and the others set the default count and options.
+//
+//	eng:2              2 subtitles for english
+//	3                  3 subtitles for other languages
+//	first              FirstOnly
+//	stophash           StopAtHash
+//
+// Example: "eng:2,fre,spa,1,first". Languages are codes or names: "en:2,fr".
+//
+func ParsePolicy(text string) (*Policy, error) {
+	p := NewPolicy(1)
+	for _, term := range strings.Split(text, ",") {
+		term = strings.TrimSpace(term)
+		if n, e := strconv.Atoi(term); e == nil {
+			p.Count = n
+			continue
+		}
+		switch strings.ToLower(term) {
+		case "":
+
+		case "first":
+			p.FirstOnly = true
+
+		case "stophash":
+			p.StopAtHash = true
+
+		default:
+			lang, count, hasCount := strings.Cut(term, ":")
+			if hasCount {
+				n, e := strconv.Atoi(count)
+				if e != nil {
+					return nil, fmt.Errorf("policy %s: %w", lang, e)
+				}
+				p.SetCount(lang, n)
+			}
+			p.Languages = append(p.Languages, p.lang(lang))
+		}
+	}
+	if e := p.Err(); e != nil {
+		return nil, e
+	}
+	return p, nil
+}
@@ -0,0 +1,216 @@
+package opensubs
+
+import (
+	xmlrpc "github.com/sqp/go-xmlrpc"
+
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+//-----------------------------------------------------------------------
+// Server info.
+//-----------------------------------------------------------------------
+
+// ServerInfo holds the server informations and statistics.
+//
+type ServerInfo struct {
+	Application   string         // Server application name and version.
+	Version       string         // XML-RPC API version.
+	URL           string         // XML-RPC endpoint.
+	UsersOnline   int            // Users online.
+	Downloads     int            // Subtitles downloaded since the start.
+	SubtitleFiles int            // Subtitle files available.
+	Movies        int            // Movies known.
+	Limits        DownloadLimits // Download limits of the client.
+
+	Raw map[string]interface{} // All fields sent by the server.
+}
+
+// DownloadLimits are the download counters of the client, by IP or by user.
+//
+type DownloadLimits struct {
+	ClientIP string // IP address seen by the server.
+	CheckBy  string // How the limit is applied: "ip" or "user".
+	Count    int    // Downloads in the last 24 hours.
+	Limit    int    // Downloads allowed by 24 hours.
+	Quota    int    // Downloads left.
+}
+
+// ServerInfo requests the server informations. No login is needed.
+//
+func (c *Client) ServerInfo(ctx context.Context) (*ServerInfo, error) {
+	res, e := c.call(ctx, "ServerInfo")
+	if e != nil {
+		return nil, e
+	}
+	toInt := func(key string) int { return atoi(fmt.Sprint(res[key])) }
+	toString := func(key string) string { s, _ := res[key].(string); return s }
+	info := &ServerInfo{
+		Raw:           res,
+		Version:       toString("xmlrpc_version"),
+		URL:           toString("xmlrpc_url"),
+		Application:   toString("application"),
+		UsersOnline:   toInt("users_online_total"),
+		Downloads:     toInt("subs_downloads"),
+		SubtitleFiles: toInt("subs_subtitle_files"),
+		Movies:        toInt("movies_total"),
+	}
+	info.Limits, _ = parseDownloadLimits(res)
+	return info, nil
+}
+
+// Parse the download_limits field of a response. Returns false if missing.
+func parseDownloadLimits(res xmlrpc.Struct) (DownloadLimits, bool) {
+	data, ok := res["download_limits"].(xmlrpc.Struct)
+	if !ok {
+		return DownloadLimits{}, false
+	}
+	toInt := func(key string) int { return atoi(fmt.Sprint(data[key])) }
+	toString := func(key string) string { s, _ := data[key].(string); return s }
+	return DownloadLimits{
+		ClientIP: toString("client_ip"),
+		CheckBy:  toString("limit_check_by"),
+		Count:    toInt("client_24h_download_count"),
+		Limit:    toInt("client_24h_download_limit"),
+		Quota:    toInt("client_download_quota"),
+	}, true
+}
+
+//-----------------------------------------------------------------------
+// Session quota.
+//-----------------------------------------------------------------------
+
+// Quota is the estimate of the downloads left for a session: the value sent
+// by the server, minus the downloads made since.
+//
+type Quota struct {
+	Limit   int       // Downloads allowed by 24 hours. 0 if unknown.
+	Left    int       // Downloads left.
+	Updated time.Time // Last server value. Zero if unknown.
+}
+
+// Known returns true if the server sent the quota in the last 24 hours.
+//
+func (q Quota) Known() bool {
+	return !q.Updated.IsZero() && time.Since(q.Updated) < 24*time.Hour
+}
+
+// Quota returns the current estimate of the downloads left.
+//
+func (s *Session) Quota() Quota {
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+	return s.quota
+}
+
+// ServerInfo requests the server informations, and updates the session
+// quota with the download limits.
+//
+func (s *Session) ServerInfo(ctx context.Context) (*ServerInfo, error) {
+	info, e := s.apiClient().ServerInfo(ctx)
+	if e != nil {
+		return nil, e
+	}
+	if _, ok := parseDownloadLimits(info.Raw); ok {
+		s.setLimits(info.Limits)
+	}
+	s.quotaMu.Lock()
+	s.quotaChecked = time.Now()
+	s.quotaMu.Unlock()
+	return info, nil
+}
+
+// The quota must be requested: unknown, and not asked in the last 24 hours
+// (the server may not send it).
+func (s *Session) quotaNeeded() bool {
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+	return !s.quota.Known() && time.Since(s.quotaChecked) >= 24*time.Hour
+}
+
+func (s *Session) setLimits(limits DownloadLimits) {
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+	s.quota = Quota{Limit: limits.Limit, Left: max(0, limits.Quota), Updated: time.Now()}
+}
+
+// Count downloads in the estimate.
+func (s *Session) useQuota(n int) {
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+	s.quota.Left = max(0, s.quota.Left-n)
+}
+
+// The server refused a download: nothing is left until the counters reset.
+func (s *Session) quotaReached() {
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+	s.quota.Left = 0
+	if s.quota.Updated.IsZero() {
+		s.quota.Updated = time.Now()
+	}
+}
+
+//-----------------------------------------------------------------------
+// Query quota check.
+//-----------------------------------------------------------------------
+
+// QuotaMode sets what a query does when its downloads exceed the quota.
+//
+type QuotaMode int
+
+// Quota modes.
+const (
+	QuotaDefer  QuotaMode = iota // Download what the quota allows, the others fail with a *QuotaError.
+	QuotaStop                    // Download nothing and return a *QuotaError.
+	QuotaIgnore                  // Don't check the quota: the server refuses the downloads over it.
+)
+
+// QuotaError is returned when downloads were not sent because they would
+// exceed the quota. It matches ErrDownloadLimit with errors.Is.
+//
+type QuotaError struct {
+	Needed int // Downloads requested.
+	Left   int // Downloads left in the quota.
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("opensubs: download quota exceeded: %d needed, %d left", e.Needed, e.Left)
+}
+
+// Is matches ErrDownloadLimit.
+func (e *QuotaError) Is(target error) bool {
+	return errors.Is(ErrDownloadLimit, target)
+}
+
+// Set the behavior when the downloads exceed the session quota. The quota is
+// requested with ServerInfo before the first download. (Chainable)
+func (q *Query) SetQuotaMode(mode QuotaMode) *Query {
+	q.quotaMode = mode
+	return q
+}
+
+// Split the ids between those the quota allows and the deferred ones.
+func (q *Query) checkQuota(ctx context.Context, ids []string) (allowed []string, deferred []string, e error) {
+	if q.quotaMode == QuotaIgnore || len(ids) == 0 {
+		return ids, nil, nil
+	}
+	if q.session.quotaNeeded() {
+		if _, e := q.session.ServerInfo(ctx); e != nil {
+			warn("quota", e) // Unknown quota: let the server decide.
+			return ids, nil, nil
+		}
+	}
+
+	quota := q.session.Quota()
+	if !quota.Known() || len(ids) <= quota.Left {
+		return ids, nil, nil
+	}
+	qerr := &QuotaError{Needed: len(ids), Left: quota.Left}
+	if q.quotaMode == QuotaStop {
+		return nil, nil, qerr
+	}
+	return ids[:quota.Left], ids[quota.Left:], qerr
+}
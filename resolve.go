@@ -0,0 +1,307 @@
+package opensubs
+
+import (
+	xmlrpc "github.com/sqp/go-xmlrpc"
+
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+//-----------------------------------------------------------------------
+// Resolution steps.
+//-----------------------------------------------------------------------
+
+// Step is a search method tried by the Resolver.
+//
+type Step int
+
+// Resolver steps, from the most reliable.
+const (
+	StepNone Step = iota // Not found by a Resolver.
+	StepHash             // Match by moviehash.
+	StepImdb             // Match by imdb id, found with CheckMovieHash or guessed from the filename.
+	StepTag              // Match by release name.
+	StepText             // Match by title (and episode) guessed from the filename.
+)
+
+func (s Step) String() string {
+	switch s {
+	case StepHash:
+		return "hash"
+	case StepImdb:
+		return "imdb"
+	case StepTag:
+		return "tag"
+	case StepText:
+		return "text"
+	}
+	return "none"
+}
+
+// DefaultStrategy tries all steps, from the most reliable.
+var DefaultStrategy = []Step{StepHash, StepImdb, StepTag, StepText}
+
+//-----------------------------------------------------------------------
+// Resolver.
+//-----------------------------------------------------------------------
+
+// Resolver finds the best available subtitle for each file and language,
+// trying the steps of its strategy in order. A step only searches the
+// files and languages not found by the previous ones.
+//
+// The step that found each subtitle is set in SubInfo.Step.
+//
+type Resolver struct {
+	Session  *Session
+	Strategy []Step
+	Scorer   Scorer // Selects the best subtitle for each file.
+	Filter   Filter // Drops unwanted subtitles. The next steps are tried if none is left.
+
+	Concurrency int // Batch requests sent at once, see Query.SetConcurrency.
+}
+
+// NewResolver creates a resolver with the default strategy.
+//
+func NewResolver(session *Session) *Resolver {
+	return &Resolver{
+		Session:  session,
+		Strategy: DefaultStrategy,
+		Scorer:   NewScorer(),
+	}
+}
+
+// Resolve searches and downloads one subtitle per file and language.
+// Languages are separated by comma, as codes or names: "eng,fr,German".
+// They must be listed: "all" and empty fail with an error.
+//
+// Results are indexed by filename. The error lists the failed steps and
+// downloads, results are still returned for the others.
+//
+func (r *Resolver) Resolve(ctx context.Context, langs string, files ...string) (map[string]SubsByLang, error) {
+	langs, e := DefaultLanguages.Normalize(langs)
+	if e != nil {
+		return nil, e
+	}
+	list := strings.Split(langs, ",")
+	if langs == "" || slices.Contains(list, "all") { // One sub by language: they must be known.
+		return nil, errors.New("resolve: list the languages, \"all\" and empty are not supported")
+	}
+	pending := make(map[string][]string) // Languages still needed by file.
+	for _, file := range files {
+		pending[file] = slices.Clone(list)
+	}
+	chosen := make(map[string]map[string]*SubInfo)
+	var errs []error
+
+	for _, step := range r.Strategy {
+		if len(pending) == 0 {
+			break
+		}
+		if e := ctx.Err(); e != nil {
+			return nil, e
+		}
+		e := r.step(ctx, step, pending, chosen)
+		if e != nil {
+			errs = append(errs, fmt.Errorf("resolve %s: %w", step, e))
+		}
+	}
+
+	res, e := r.download(ctx, chosen)
+	if e != nil {
+		errs = append(errs, e)
+	}
+	return res, errors.Join(errs...)
+}
+
+// Search the pending files with one step, and move those found to chosen.
+func (r *Resolver) step(ctx context.Context, step Step, pending map[string][]string, chosen map[string]map[string]*SubInfo) error {
+	q := NewQuerySession(r.Session).SetConcurrency(r.Concurrency)
+	refs := make(map[string][]string) // Files by step result reference.
+
+	switch step {
+	case StepHash:
+		for file, langs := range pending {
+			q.AddFile(file, strings.Join(langs, ","))
+		}
+		for hash, file := range q.hashs {
+			refs[hash] = append(refs[hash], file)
+		}
+
+	case StepImdb:
+		imdbs, e := r.findImdbs(ctx, pending)
+		if e != nil {
+			return e
+		}
+		for file, imdb := range imdbs {
+			if len(refs[imdb]) == 0 {
+				q.AddImdb(imdb, strings.Join(pending[file], ","))
+			}
+			refs[imdb] = append(refs[imdb], file)
+		}
+
+	case StepTag:
+		for file, langs := range pending {
+			release := ParseName(file).Release
+			q.AddTag(release, strings.Join(langs, ","))
+			refs[release] = append(refs[release], file)
+		}
+
+	case StepText:
+		for file, langs := range pending {
+			p := ParseName(file)
+			if p.Title == "" {
+				continue
+			}
+			q.AddName(file, strings.Join(langs, ","))
+			ref := p.Query()
+			if p.IsEpisode() {
+				ref = EpisodeRef(p.Title, p.Season, p.Episode)
+			}
+			refs[ref] = append(refs[ref], file)
+		}
+
+	default:
+		return fmt.Errorf("unknown step %d", step)
+	}
+
+	if len(q.listArgs) == 0 {
+		return nil
+	}
+	if e := q.search(ctx); e != nil {
+		return e
+	}
+
+	for _, byref := range []subByRef{q.byhash, q.byimdb, q.bytag, q.bytext, q.byepisode} {
+		for ref, bylang := range byref {
+			for _, file := range refs[ref] {
+				for lang, list := range bylang {
+					list = filterSubs(list, r.Filter)
+					if len(list) == 0 || !removeLang(pending, file, lang) {
+						continue
+					}
+					sortByScore(list, r.Scorer, file)
+					sub := list[0]
+					sub.Step = step
+					if chosen[file] == nil {
+						chosen[file] = make(map[string]*SubInfo)
+					}
+					chosen[file][lang] = sub
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Find imdb ids for pending files: by CheckMovieHash, or guessed from the
+// filename with GuessMovieFromString.
+func (r *Resolver) findImdbs(ctx context.Context, pending map[string][]string) (map[string]string, error) {
+	imdbs := make(map[string]string)
+	hashs := make(map[string]string)
+	for file := range pending {
+		if hash, _, e := HashFile(file); e == nil {
+			hashs[hash] = file
+		}
+	}
+
+	if len(hashs) > 0 {
+		list := make([]string, 0, len(hashs))
+		for hash := range hashs {
+			list = append(list, hash)
+		}
+		res, e := r.Session.call(ctx, "CheckMovieHash", list)
+		if e != nil {
+			return nil, e
+		}
+		data, _ := res["data"].(xmlrpc.Struct)
+		for hash, file := range hashs {
+			if movie, ok := data[hash].(xmlrpc.Struct); ok {
+				if imdb, _ := movie["MovieImdbID"].(string); imdb != "" && imdb != "0" {
+					imdbs[file] = imdb
+				}
+			}
+		}
+	}
+
+	guess := make(map[string][]string) // Files by release name.
+	var names []string
+	for file := range pending {
+		if _, ok := imdbs[file]; !ok {
+			name := ParseName(file).Release
+			if len(guess[name]) == 0 {
+				names = append(names, name)
+			}
+			guess[name] = append(guess[name], file)
+		}
+	}
+	if len(names) == 0 {
+		return imdbs, nil
+	}
+
+	res, e := r.Session.call(ctx, "GuessMovieFromString", names)
+	if e != nil {
+		return imdbs, e
+	}
+	data, _ := res["data"].(xmlrpc.Struct)
+	for name, files := range guess {
+		movie, _ := data[name].(xmlrpc.Struct)
+		best, _ := movie["BestGuess"].(xmlrpc.Struct)
+		if imdb, _ := best["IDMovieIMDB"].(string); imdb != "" {
+			for _, file := range files {
+				imdbs[file] = imdb
+			}
+		}
+	}
+	return imdbs, nil
+}
+
+// Download the chosen subs and index them by file.
+func (r *Resolver) download(ctx context.Context, chosen map[string]map[string]*SubInfo) (map[string]SubsByLang, error) {
+	var ids []string
+	needed := make(subIndex)
+	for _, bylang := range chosen {
+		for _, sub := range bylang {
+			if _, ok := needed[sub.IDSubtitleFile]; !ok {
+				needed[sub.IDSubtitleFile] = sub
+				ids = append(ids, sub.IDSubtitleFile)
+			}
+		}
+	}
+
+	_, e := NewQuerySession(r.Session).SetConcurrency(r.Concurrency).download(ctx, ids, needed)
+
+	res := make(map[string]SubsByLang)
+	for file, bylang := range chosen {
+		for lang, sub := range bylang {
+			if !sub.Downloaded() { // Download failed, reported in e.
+				continue
+			}
+			if res[file] == nil {
+				res[file] = make(SubsByLang)
+			}
+			res[file][lang] = []*SubInfo{sub}
+		}
+	}
+	return res, e
+}
+
+// Remove the language from the file pending list. Returns false if it
+// wasn't pending.
+func removeLang(pending map[string][]string, file, lang string) bool {
+	langs := pending[file]
+	for i, l := range langs {
+		if l == lang {
+			langs = append(langs[:i], langs[i+1:]...)
+			if len(langs) == 0 {
+				delete(pending, file)
+			} else {
+				pending[file] = langs
+			}
+			return true
+		}
+	}
+	return false
+}
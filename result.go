@@ -0,0 +1,241 @@
+package opensubs
+
+import (
+	"context"
+	"iter"
+	"sort"
+)
+
+//-----------------------------------------------------------------------
+// Result.
+//-----------------------------------------------------------------------
+
+// Result holds the downloaded subtitles of a query, indexed by their source
+// reference: the filename when matched by hash, the imdb id, the episode
+// reference (see EpisodeRef), the release name for tag searches, or the query
+// text for full text searches.
+//
+// Lists are ordered with the best subtitle first, in the order of Best.
+//
+type Result struct {
+	byhash    subByRef
+	byimdb    subByRef
+	bytag     subByRef
+	bytext    subByRef
+	byepisode subByRef
+}
+
+// SubsByLang lists the subtitles of one reference by language.
+//
+type SubsByLang map[string][]*SubInfo
+
+// Languages returns the sorted list of languages.
+//
+func (bylang SubsByLang) Languages() []string {
+	langs := make([]string, 0, len(bylang))
+	for lang := range bylang {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Best returns the first subtitle of the language, or nil.
+//
+func (bylang SubsByLang) Best(lang string) *SubInfo {
+	if list := bylang[lang]; len(list) > 0 {
+		return list[0]
+	}
+	return nil
+}
+
+// GetResult downloads the subtitles like Get, and returns them as a Result.
+// The error is the same as for Download.
+//
+func (q *Query) GetResult(ctx context.Context, n int) (*Result, error) {
+	return q.get(ctx, n)
+}
+
+func newResult() *Result {
+	return &Result{
+		byhash:    make(subByRef),
+		byimdb:    make(subByRef),
+		bytag:     make(subByRef),
+		bytext:    make(subByRef),
+		byepisode: make(subByRef),
+	}
+}
+
+// ByFile returns the subtitles matched by hash for the file, or nil.
+//
+func (r *Result) ByFile(filename string) SubsByLang {
+	return exportLangs(r.byhash[filename])
+}
+
+// ByImdb returns the subtitles matched by imdb id, or nil.
+//
+func (r *Result) ByImdb(imdb string) SubsByLang {
+	return exportLangs(r.byimdb[imdb])
+}
+
+// ByEpisode returns the subtitles matched by an episode search, or nil.
+// The series is the imdb id or query text given to the search.
+//
+func (r *Result) ByEpisode(series string, season, episode int) SubsByLang {
+	return exportLangs(r.byepisode[EpisodeRef(series, season, episode)])
+}
+
+// ByTag returns the subtitles matched by release name, or nil.
+//
+func (r *Result) ByTag(releaseName string) SubsByLang {
+	return exportLangs(r.bytag[releaseName])
+}
+
+// ByQuery returns the subtitles matched by full text query, or nil.
+//
+func (r *Result) ByQuery(text string) SubsByLang {
+	return exportLangs(r.bytext[text])
+}
+
+// Files iterates over the files matched by hash, and their subtitles.
+//
+func (r *Result) Files() iter.Seq2[string, SubsByLang] {
+	return iterRefs(r.byhash)
+}
+
+// Imdbs iterates over the imdb ids matched, and their subtitles.
+//
+func (r *Result) Imdbs() iter.Seq2[string, SubsByLang] {
+	return iterRefs(r.byimdb)
+}
+
+// Episodes iterates over the episodes matched, and their subtitles.
+// Keys are episode references, see EpisodeRef.
+//
+func (r *Result) Episodes() iter.Seq2[string, SubsByLang] {
+	return iterRefs(r.byepisode)
+}
+
+// Tags iterates over the release names matched, and their subtitles.
+//
+func (r *Result) Tags() iter.Seq2[string, SubsByLang] {
+	return iterRefs(r.bytag)
+}
+
+// Queries iterates over the full text queries matched, and their subtitles.
+//
+func (r *Result) Queries() iter.Seq2[string, SubsByLang] {
+	return iterRefs(r.bytext)
+}
+
+// All iterates over all subtitles, ordered by match type: hash, episode,
+// imdb, tag then full text.
+//
+func (r *Result) All() iter.Seq[*SubInfo] {
+	return func(yield func(*SubInfo) bool) {
+		for _, byref := range []subByRef{r.byhash, r.byepisode, r.byimdb, r.bytag, r.bytext} {
+			for _, ref := range sortedKeys(byref) {
+				for _, lang := range exportLangs(byref[ref]).Languages() {
+					for _, sub := range byref[ref][lang] {
+						if !yield(sub) {
+							return
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// Len returns the number of subtitles.
+//
+func (r *Result) Len() int {
+	count := 0
+	for range r.All() {
+		count++
+	}
+	return count
+}
+
+// Languages returns the sorted list of languages found.
+//
+func (r *Result) Languages() []string {
+	found := make(SubsByLang)
+	for sub := range r.All() {
+		found[sub.SubLanguageID] = nil
+	}
+	return found.Languages()
+}
+
+// Best returns the best subtitle for the language, or nil.
+// The highest score is preferred, then the best match type (see
+// SubInfo.MatchRank), then the most downloaded.
+//
+func (r *Result) Best(lang string) *SubInfo {
+	var best *SubInfo
+	for sub := range r.All() {
+		if sub.SubLanguageID != lang {
+			continue
+		}
+		if best == nil || better(sub, best) {
+			best = sub
+		}
+	}
+	return best
+}
+
+//-----------------------------------------------------------------------
+// Result internals.
+//-----------------------------------------------------------------------
+
+// Whether a is a better subtitle than b, in the order used by Result.Best.
+func better(a, b *SubInfo) bool {
+	switch {
+	case a.Scoring.Total != b.Scoring.Total:
+		return a.Scoring.Total > b.Scoring.Total
+	case a.MatchRank() != b.MatchRank():
+		return a.MatchRank() < b.MatchRank()
+	}
+	return a.Downloads() > b.Downloads()
+}
+
+// Sort every list with the best subtitle first.
+func (res *Result) sortBest() {
+	for _, byref := range []subByRef{res.byhash, res.byimdb, res.bytag, res.bytext, res.byepisode} {
+		for _, bylang := range byref {
+			for _, list := range bylang {
+				sort.SliceStable(list, func(i, j int) bool { return better(list[i], list[j]) })
+			}
+		}
+	}
+}
+
+func iterRefs(byref subByRef) iter.Seq2[string, SubsByLang] {
+	return func(yield func(string, SubsByLang) bool) {
+		for _, ref := range sortedKeys(byref) {
+			if !yield(ref, exportLangs(byref[ref])) {
+				return
+			}
+		}
+	}
+}
+
+func exportLangs(bylang subByLang) SubsByLang {
+	if bylang == nil {
+		return nil
+	}
+	out := make(SubsByLang, len(bylang))
+	for lang, list := range bylang {
+		out[lang] = list
+	}
+	return out
+}
+
+func sortedKeys(byref subByRef) []string {
+	keys := make([]string, 0, len(byref))
+	for ref := range byref {
+		keys = append(keys, ref)
+	}
+	sort.Strings(keys)
+	return keys
+}
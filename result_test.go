@@ -0,0 +1,32 @@
+package opensubs
+
+import "testing"
+
+func TestResultSortBest(t *testing.T) {
+	sub := func(id string, score float64, matched, downloads string) *SubInfo {
+		s := &SubInfo{IDSubtitleFile: id, SubLanguageID: "eng", MatchedBy: matched, SubDownloadsCnt: downloads}
+		s.Scoring.Total = score
+		return s
+	}
+	res := newResult()
+	for _, s := range []*SubInfo{ // Server order.
+		sub("low", 1, "moviehash", "900"),
+		sub("tag", 5, "tag", "900"),
+		sub("few", 5, "moviehash", "10"),
+		sub("many", 5, "moviehash", "500"),
+	} {
+		res.byhash.addSub(s, "movie.avi")
+	}
+	res.sortBest()
+
+	want := []string{"many", "few", "tag", "low"}
+	list := res.byhash["movie.avi"]["eng"]
+	for i, s := range list {
+		if s.IDSubtitleFile != want[i] {
+			t.Fatalf("sorted list[%d] = %s, want %v", i, s.IDSubtitleFile, want)
+		}
+	}
+	if best := res.byhash["movie.avi"]["eng"][0]; best != res.Best("eng") {
+		t.Errorf("SubsByLang.Best = %s, Result.Best = %s", best.IDSubtitleFile, res.Best("eng").IDSubtitleFile)
+	}
+}
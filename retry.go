@@ -0,0 +1,158 @@
+package opensubs
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//-----------------------------------------------------------------------
+// Rate limiter.
+//-----------------------------------------------------------------------
+
+// Requests limit documented by the server: 40 requests by 10 seconds by IP.
+const (
+	DefaultRateRequests = 40
+	DefaultRateWindow   = 10 * time.Second
+)
+
+// RateLimiter spaces the requests of a client: at most Requests in any
+// Window. It can be shared by many clients using the same server.
+//
+type RateLimiter struct {
+	Requests int           // Requests allowed by window. 0 for unlimited.
+	Window   time.Duration // Duration of the window.
+
+	mu   sync.Mutex
+	sent []time.Time // Requests in the current window, oldest first.
+}
+
+// NewRateLimiter creates a limiter allowing requests by window.
+//
+func NewRateLimiter(requests int, window time.Duration) *RateLimiter {
+	return &RateLimiter{Requests: requests, Window: window}
+}
+
+// Wait blocks until a request can be sent, or the context is done.
+//
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil || l.Requests <= 0 {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		for len(l.sent) > 0 && now.Sub(l.sent[0]) >= l.Window {
+			l.sent = l.sent[1:]
+		}
+		if len(l.sent) < l.Requests {
+			l.sent = append(l.sent, now)
+			l.mu.Unlock()
+			return nil
+		}
+		wait := l.Window - now.Sub(l.sent[0])
+		l.mu.Unlock()
+
+		if e := sleep(ctx, wait); e != nil {
+			return e
+		}
+	}
+}
+
+//-----------------------------------------------------------------------
+// Retry.
+//-----------------------------------------------------------------------
+
+// Backoff retries the requests that failed with a temporary error: too many
+// requests (429), service unavailable (503), bad gateway (502), gateway
+// timeout (504) or a transport error.
+//
+// The delay doubles after each retry, with a random jitter, and a
+// Retry-After header sent by the server is respected.
+//
+type Backoff struct {
+	Retries  int           // Retries after the first attempt. 0 disables them.
+	MinDelay time.Duration // Delay before the first retry.
+	MaxDelay time.Duration // Max delay between retries.
+
+	// OnRetry is called before each retry, with the retry number from 1, the
+	// delay before it, and the error of the failed attempt.
+	OnRetry func(method string, retry int, delay time.Duration, e error)
+}
+
+// NewBackoff creates a backoff with 4 retries, from 1 to 30 seconds.
+//
+func NewBackoff() *Backoff {
+	return &Backoff{Retries: 4, MinDelay: time.Second, MaxDelay: 30 * time.Second}
+}
+
+// Delay before the retry (from 1): half of the exponential delay, plus a
+// random part up to the other half.
+func (b *Backoff) delay(retry int, e error) time.Duration {
+	d := b.MinDelay << (retry - 1)
+	if d > b.MaxDelay || d <= 0 {
+		d = b.MaxDelay
+	}
+	if half := d / 2; half > 0 {
+		d = half + rand.N(half)
+	}
+
+	var se *StatusError
+	if errors.As(e, &se) && se.retryAfter > d {
+		d = se.retryAfter
+	}
+	return d
+}
+
+// The error is temporary: the request can be sent again.
+func retryable(e error) bool {
+	var se *StatusError
+	switch {
+	case e == nil, errors.Is(e, context.Canceled), errors.Is(e, context.DeadlineExceeded):
+		return false
+
+	case errors.As(e, &se):
+		switch se.Code {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	var te *transportError
+	return errors.As(e, &te)
+}
+
+// transportError is a failure to send the request or get the response.
+type transportError struct {
+	err error
+}
+
+func (e *transportError) Error() string { return e.err.Error() }
+func (e *transportError) Unwrap() error { return e.err }
+
+// Parse a Retry-After header, in seconds or as a date.
+func parseRetryAfter(value string) time.Duration {
+	if sec, e := strconv.Atoi(value); e == nil && sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+	if t, e := http.ParseTime(value); e == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// Wait for the duration, or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
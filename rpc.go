@@ -0,0 +1,216 @@
+package opensubs
+
+import (
+	xmlrpc "github.com/sqp/go-xmlrpc"
+
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//-----------------------------------------------------------------------
+// XML-RPC encoding.
+//-----------------------------------------------------------------------
+
+// Only the small subset of XML-RPC used by the OpenSubtitles API is handled
+// here. Decoded values use the xmlrpc types so the results can be parsed
+// like those of xmlrpc.Call.
+
+// Build the methodCall document for the given method and arguments.
+func encodeCall(name string, args ...interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteString(xml.Header)
+	buf.WriteString("<methodCall><methodName>")
+	xml.EscapeText(buf, []byte(name))
+	buf.WriteString("</methodName><params>")
+	for _, arg := range args {
+		buf.WriteString("<param>")
+		if e := encodeValue(buf, reflect.ValueOf(arg)); e != nil {
+			return nil, e
+		}
+		buf.WriteString("</param>")
+	}
+	buf.WriteString("</params></methodCall>")
+	return buf.Bytes(), nil
+}
+
+func encodeValue(buf *bytes.Buffer, v reflect.Value) error {
+	if v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			buf.WriteString("<value><nil/></value>")
+			return nil
+		}
+		return encodeValue(buf, v.Elem())
+	}
+
+	buf.WriteString("<value>")
+	switch v.Kind() {
+	case reflect.Invalid:
+		buf.WriteString("<nil/>")
+
+	case reflect.String:
+		buf.WriteString("<string>")
+		xml.EscapeText(buf, []byte(v.String()))
+		buf.WriteString("</string>")
+
+	case reflect.Bool:
+		b := "0"
+		if v.Bool() {
+			b = "1"
+		}
+		buf.WriteString("<boolean>" + b + "</boolean>")
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		buf.WriteString("<int>" + strconv.FormatInt(v.Int(), 10) + "</int>")
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		buf.WriteString("<int>" + strconv.FormatUint(v.Uint(), 10) + "</int>")
+
+	case reflect.Float32, reflect.Float64:
+		buf.WriteString("<double>" + strconv.FormatFloat(v.Float(), 'f', -1, 64) + "</double>")
+
+	case reflect.Slice, reflect.Array:
+		buf.WriteString("<array><data>")
+		for i := 0; i < v.Len(); i++ {
+			if e := encodeValue(buf, v.Index(i)); e != nil {
+				return e
+			}
+		}
+		buf.WriteString("</data></array>")
+
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("xmlrpc: unsupported map key %s", v.Type().Key())
+		}
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys) // Stable output.
+
+		buf.WriteString("<struct>")
+		for _, k := range keys {
+			buf.WriteString("<member><name>")
+			xml.EscapeText(buf, []byte(k))
+			buf.WriteString("</name>")
+			if e := encodeValue(buf, v.MapIndex(reflect.ValueOf(k).Convert(v.Type().Key()))); e != nil {
+				return e
+			}
+			buf.WriteString("</member>")
+		}
+		buf.WriteString("</struct>")
+
+	default:
+		return fmt.Errorf("xmlrpc: unsupported type %s", v.Type())
+	}
+	buf.WriteString("</value>")
+	return nil
+}
+
+//-----------------------------------------------------------------------
+// XML-RPC decoding.
+//-----------------------------------------------------------------------
+
+// Intermediate representation of a response value.
+type rpcValue struct {
+	Text   string     `xml:",chardata"`
+	String *string    `xml:"string"`
+	Int    *string    `xml:"int"`
+	I4     *string    `xml:"i4"`
+	Bool   *string    `xml:"boolean"`
+	Double *string    `xml:"double"`
+	Date   *string    `xml:"dateTime.iso8601"`
+	Base64 *string    `xml:"base64"`
+	Nil    *struct{}  `xml:"nil"`
+	Struct *rpcStruct `xml:"struct"`
+	Array  *rpcArray  `xml:"array"`
+}
+
+type rpcStruct struct {
+	Members []rpcMember `xml:"member"`
+}
+
+type rpcArray struct {
+	Data []rpcValue `xml:"data>value"`
+}
+
+type rpcMember struct {
+	Name  string   `xml:"name"`
+	Value rpcValue `xml:"value"`
+}
+
+type rpcResponse struct {
+	Params []rpcValue `xml:"params>param>value"`
+	Fault  *rpcValue  `xml:"fault>value"`
+}
+
+// Parse a methodResponse document. Returns the first param value.
+func decodeResponse(r io.Reader) (interface{}, error) {
+	var resp rpcResponse
+	if e := xml.NewDecoder(r).Decode(&resp); e != nil {
+		return nil, e
+	}
+	if resp.Fault != nil {
+		fault, _ := resp.Fault.value().(xmlrpc.Struct)
+		return nil, fmt.Errorf("xmlrpc fault %v: %v", fault["faultCode"], fault["faultString"])
+	}
+	if len(resp.Params) == 0 {
+		return nil, errors.New("xmlrpc: empty response")
+	}
+	return resp.Params[0].value(), nil
+}
+
+func (v *rpcValue) value() interface{} {
+	switch {
+	case v.String != nil:
+		return *v.String
+
+	case v.Int != nil:
+		return parseRPCInt(*v.Int)
+
+	case v.I4 != nil:
+		return parseRPCInt(*v.I4)
+
+	case v.Bool != nil:
+		return strings.TrimSpace(*v.Bool) == "1"
+
+	case v.Double != nil:
+		f, _ := strconv.ParseFloat(strings.TrimSpace(*v.Double), 64)
+		return f
+
+	case v.Date != nil:
+		return *v.Date
+
+	case v.Base64 != nil:
+		return *v.Base64
+
+	case v.Nil != nil:
+		return nil
+
+	case v.Struct != nil:
+		st := make(xmlrpc.Struct, len(v.Struct.Members))
+		for i := range v.Struct.Members {
+			st[v.Struct.Members[i].Name] = v.Struct.Members[i].Value.value()
+		}
+		return st
+
+	case v.Array != nil:
+		arr := make(xmlrpc.Array, len(v.Array.Data))
+		for i := range v.Array.Data {
+			arr[i] = v.Array.Data[i].value()
+		}
+		return arr
+	}
+	return v.Text // No type: string.
+}
+
+func parseRPCInt(s string) int {
+	i, _ := strconv.Atoi(strings.TrimSpace(s))
+	return i
+}
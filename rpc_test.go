@@ -0,0 +1,127 @@
+package opensubs
+
+import (
+	xmlrpc "github.com/sqp/go-xmlrpc"
+
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Build a methodResponse with the value encoded like a call argument.
+func encodeResponse(t *testing.T, arg interface{}) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString(`<?xml version="1.0"?><methodResponse><params><param>`)
+	if e := encodeValue(buf, reflect.ValueOf(arg)); e != nil {
+		t.Fatal(e)
+	}
+	buf.WriteString(`</param></params></methodResponse>`)
+	return buf.Bytes()
+}
+
+func TestRPCRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  interface{}
+		want interface{}
+	}{
+		{"string", "a <b> & c", "a <b> & c"},
+		{"int", 42, 42},
+		{"negative int", int64(-7), -7},
+		{"double", 0.25, 0.25},
+		{"bool", true, true},
+		{"nil", nil, nil},
+		{"array", []string{"eng", "fre"}, xmlrpc.Array{"eng", "fre"}},
+		{"struct", map[string]interface{}{"imdbid": "0066921", "season": 2, "rating": 7.5},
+			xmlrpc.Struct{"imdbid": "0066921", "season": 2, "rating": 7.5}},
+		{"nested", []interface{}{map[string]string{"tag": "Movie.2012"}, []int{1, 2}},
+			xmlrpc.Array{xmlrpc.Struct{"tag": "Movie.2012"}, xmlrpc.Array{1, 2}}},
+	}
+
+	for _, tt := range tests {
+		got, e := decodeResponse(bytes.NewReader(encodeResponse(t, tt.arg)))
+		if e != nil {
+			t.Errorf("%s: decode error %v", tt.name, e)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeCall(t *testing.T) {
+	data, e := encodeCall("LogIn", "user", "", "en", "UA & co")
+	if e != nil {
+		t.Fatal(e)
+	}
+	want := `<methodCall><methodName>LogIn</methodName><params>` +
+		`<param><value><string>user</string></value></param>` +
+		`<param><value><string></string></value></param>` +
+		`<param><value><string>en</string></value></param>` +
+		`<param><value><string>UA &amp; co</string></value></param>` +
+		`</params></methodCall>`
+	if !strings.HasSuffix(string(data), want) {
+		t.Errorf("encodeCall() = %s, want suffix %s", data, want)
+	}
+
+	if _, e := encodeCall("X", make(chan int)); e == nil {
+		t.Error("encodeCall(chan) returned no error")
+	}
+	if _, e := encodeCall("X", map[int]string{1: "a"}); e == nil {
+		t.Error("encodeCall(map[int]string) returned no error")
+	}
+}
+
+func TestDecodeResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want interface{}
+		err  string
+	}{
+		{"untyped string",
+			`<methodResponse><params><param><value>200 OK</value></param></params></methodResponse>`,
+			"200 OK", ""},
+		{"i4",
+			`<methodResponse><params><param><value><i4> 12 </i4></value></param></params></methodResponse>`,
+			12, ""},
+		{"boolean false",
+			`<methodResponse><params><param><value><boolean>0</boolean></value></param></params></methodResponse>`,
+			false, ""},
+		{"struct",
+			`<methodResponse><params><param><value><struct>` +
+				`<member><name>status</name><value><string>200 OK</string></value></member>` +
+				`<member><name>seconds</name><value><double>0.031</double></value></member>` +
+				`<member><name>data</name><value><array><data>` +
+				`<value><struct><member><name>IDSubtitleFile</name><value><string>1951894257</string></value></member></struct></value>` +
+				`</data></array></value></member>` +
+				`</struct></value></param></params></methodResponse>`,
+			xmlrpc.Struct{"status": "200 OK", "seconds": 0.031,
+				"data": xmlrpc.Array{xmlrpc.Struct{"IDSubtitleFile": "1951894257"}}}, ""},
+		{"fault",
+			`<methodResponse><fault><value><struct>` +
+				`<member><name>faultCode</name><value><int>4</int></value></member>` +
+				`<member><name>faultString</name><value><string>Too many parameters</string></value></member>` +
+				`</struct></value></fault></methodResponse>`,
+			nil, "xmlrpc fault 4: Too many parameters"},
+		{"empty",
+			`<methodResponse><params></params></methodResponse>`,
+			nil, "xmlrpc: empty response"},
+	}
+
+	for _, tt := range tests {
+		got, e := decodeResponse(strings.NewReader(tt.body))
+		switch {
+		case tt.err != "" && (e == nil || e.Error() != tt.err):
+			t.Errorf("%s: error %v, want %q", tt.name, e, tt.err)
+
+		case tt.err == "" && e != nil:
+			t.Errorf("%s: error %v", tt.name, e)
+
+		case !reflect.DeepEqual(got, tt.want):
+			t.Errorf("%s: got %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+}
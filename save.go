@@ -0,0 +1,209 @@
+package opensubs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//-----------------------------------------------------------------------
+// Save options.
+//-----------------------------------------------------------------------
+
+// SaveMode sets what happens when the subtitle file already exists.
+//
+type SaveMode int
+
+// Save modes.
+const (
+	SaveFail      SaveMode = iota // Return an error matching fs.ErrExist.
+	SaveSkip                      // Keep the existing file, nothing is written.
+	SaveOverwrite                 // Replace the existing file.
+	SaveKeepBoth                  // Write to a free name with a number: "movie.1.srt".
+	SaveBackup                    // Rename the existing file with a ".bak" suffix, replacing an older backup.
+)
+
+// SaveOptions sets how a subtitle file is written.
+//
+type SaveOptions struct {
+	Mode   SaveMode    // What to do when the file exists.
+	Perm   fs.FileMode // Permissions of the file, set as is (umask not applied). 0 for 0644.
+	Atomic bool        // Write to a temporary file moved when complete, so a failed write leaves no partial file.
+}
+
+// Save writes the downloaded file with the options. It returns the path of the
+// file written, which differs from filename with SaveKeepBoth, and is empty
+// when skipped.
+//
+// A failed write returns the error, and the partial file is removed. With
+// SaveBackup, the existing file is restored.
+//
+func (sub SubInfo) Save(filename string, opts SaveOptions) (string, error) {
+	if !sub.Downloaded() {
+		return "", fmt.Errorf("save %s: subtitle %s not downloaded", filename, sub.IDSubtitleFile)
+	}
+	return saveFile(filename, sub.Open(), opts)
+}
+
+// ParseSaveMode returns the mode by its name, for command line options:
+// "fail", "skip", "overwrite", "keep" or "backup".
+//
+func ParseSaveMode(name string) (SaveMode, error) {
+	switch strings.ToLower(name) {
+	case "fail", "":
+		return SaveFail, nil
+	case "skip":
+		return SaveSkip, nil
+	case "overwrite":
+		return SaveOverwrite, nil
+	case "keep", "keepboth", "keep-both":
+		return SaveKeepBoth, nil
+	case "backup":
+		return SaveBackup, nil
+	}
+	return SaveFail, fmt.Errorf("unknown save mode %q", name)
+}
+
+//-----------------------------------------------------------------------
+// Write files.
+//-----------------------------------------------------------------------
+
+func saveFile(filename string, reader io.Reader, opts SaveOptions) (string, error) {
+	if opts.Perm == 0 {
+		opts.Perm = 0644
+	}
+
+	_, e := os.Stat(filename)
+	exists := e == nil
+	switch {
+	case !exists:
+
+	case opts.Mode == SaveFail:
+		return "", &fs.PathError{Op: "save", Path: filename, Err: fs.ErrExist}
+
+	case opts.Mode == SaveSkip:
+		return "", nil
+
+	case opts.Mode == SaveKeepBoth:
+		filename, e = freeName(filename)
+		if e != nil {
+			return "", e
+		}
+	}
+
+	backup := exists && opts.Mode == SaveBackup
+	replace := opts.Mode == SaveOverwrite // Other modes never replace a file created since the check.
+	if opts.Atomic {
+		e = writeAtomic(filename, reader, opts.Perm, replace, backup)
+	} else {
+		e = writeFile(filename, reader, opts.Perm, replace, backup)
+	}
+	if e != nil {
+		return "", e
+	}
+	return filename, nil
+}
+
+// Write the file in place. With backup, the existing file is renamed first,
+// and restored if the write fails.
+func writeFile(filename string, reader io.Reader, perm fs.FileMode, replace, backup bool) error {
+	if backup {
+		if e := os.Rename(filename, filename+".bak"); e != nil {
+			return e
+		}
+	}
+
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !replace {
+		flag |= os.O_EXCL
+	}
+	file, e := os.OpenFile(filename, flag, perm)
+	if e == nil {
+		_, e = io.Copy(file, reader)
+		if e == nil {
+			e = file.Chmod(perm) // Same mode as the atomic write: no umask, and set on overwrite.
+		}
+		if ec := file.Close(); e == nil {
+			e = ec
+		}
+		if e != nil {
+			os.Remove(filename)
+		}
+	}
+	if e != nil && backup {
+		os.Rename(filename+".bak", filename)
+	}
+	return e
+}
+
+// Write to a temporary file in the same directory, then move it to filename:
+// renamed to replace, or linked so an existing file is never replaced. With
+// backup, the existing file is only renamed once the new one is complete.
+func writeAtomic(filename string, reader io.Reader, perm fs.FileMode, replace, backup bool) error {
+	tmp, e := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if e != nil {
+		return e
+	}
+	defer os.Remove(tmp.Name()) // Already moved when it succeeds.
+
+	_, e = io.Copy(tmp, reader)
+	if e == nil {
+		e = tmp.Chmod(perm)
+	}
+	if e == nil {
+		e = tmp.Sync()
+	}
+	if ec := tmp.Close(); e == nil {
+		e = ec
+	}
+	if e != nil {
+		return e
+	}
+
+	if replace {
+		return os.Rename(tmp.Name(), filename)
+	}
+	if backup {
+		if e := os.Rename(filename, filename+".bak"); e != nil {
+			return e
+		}
+	}
+	e = linkFile(tmp.Name(), filename) // Fails if the file exists.
+	if errors.Is(e, errors.ErrUnsupported) || errors.Is(e, fs.ErrPermission) {
+		e = copyExcl(tmp.Name(), filename, perm) // No hard links: FAT, SMB, FUSE...
+	}
+	if e != nil && backup {
+		os.Rename(filename+".bak", filename)
+	}
+	return e
+}
+
+// Create the file by link, replaced in tests.
+var linkFile = os.Link
+
+// Copy the complete temporary file to a new file, for filesystems without
+// hard links. A failed copy is removed.
+func copyExcl(tmpName, filename string, perm fs.FileMode) error {
+	tmp, e := os.Open(tmpName)
+	if e != nil {
+		return e
+	}
+	defer tmp.Close()
+	return writeFile(filename, tmp, perm, false, false)
+}
+// Find a free name with a number before the extension: "movie.1.srt".
+func freeName(filename string) (string, error) {
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+	for i := 1; i < 1000; i++ {
+		name := fmt.Sprintf("%s.%d%s", base, i, ext)
+		if _, e := os.Stat(name); errors.Is(e, fs.ErrNotExist) {
+			return name, nil
+		}
+	}
+	return "", &fs.PathError{Op: "save", Path: filename, Err: fs.ErrExist}
+}
@@ -0,0 +1,124 @@
+package opensubs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+type failReader struct{}
+
+func (failReader) Read([]byte) (int, error) { return 0, errors.New("read failed") }
+
+func readFile(t *testing.T, filename string) string {
+	data, e := os.ReadFile(filename)
+	if e != nil {
+		return "<" + e.Error() + ">"
+	}
+	return string(data)
+}
+
+func TestSaveModes(t *testing.T) {
+	tests := []struct {
+		mode    SaveMode
+		written string // Base name of the returned path.
+		files   map[string]string
+		err     error
+	}{
+		{SaveFail, "", map[string]string{"sub.srt": "old"}, fs.ErrExist},
+		{SaveSkip, "", map[string]string{"sub.srt": "old"}, nil},
+		{SaveOverwrite, "sub.srt", map[string]string{"sub.srt": "new"}, nil},
+		{SaveKeepBoth, "sub.1.srt", map[string]string{"sub.srt": "old", "sub.1.srt": "new"}, nil},
+		{SaveBackup, "sub.srt", map[string]string{"sub.srt": "new", "sub.srt.bak": "old"}, nil},
+	}
+
+	for _, atomic := range []bool{false, true} {
+		for _, tt := range tests {
+			dir := t.TempDir()
+			filename := filepath.Join(dir, "sub.srt")
+			os.WriteFile(filename, []byte("old"), 0644)
+
+			got, e := saveFile(filename, strings.NewReader("new"), SaveOptions{Mode: tt.mode, Atomic: atomic})
+			if got != "" {
+				got = filepath.Base(got)
+			}
+			if got != tt.written || !errors.Is(e, tt.err) {
+				t.Errorf("mode %d atomic %t: saveFile() = %q, %v, want %q, %v", tt.mode, atomic, got, e, tt.written, tt.err)
+			}
+			entries, _ := os.ReadDir(dir)
+			if len(entries) != len(tt.files) {
+				t.Errorf("mode %d atomic %t: %d files, want %d", tt.mode, atomic, len(entries), len(tt.files))
+			}
+			for name, want := range tt.files {
+				if data := readFile(t, filepath.Join(dir, name)); data != want {
+					t.Errorf("mode %d atomic %t: %s = %q, want %q", tt.mode, atomic, name, data, want)
+				}
+			}
+		}
+	}
+}
+
+func TestSaveNewFile(t *testing.T) {
+	for _, atomic := range []bool{false, true} {
+		filename := filepath.Join(t.TempDir(), "sub.srt")
+		got, e := saveFile(filename, strings.NewReader("new"), SaveOptions{Perm: 0600, Atomic: atomic})
+		if e != nil || got != filename || readFile(t, filename) != "new" {
+			t.Errorf("atomic %t: saveFile() = %q, %v", atomic, got, e)
+		}
+		if stat, e := os.Stat(filename); e != nil || stat.Mode().Perm() != 0600 {
+			t.Errorf("atomic %t: mode %v, want 0600", atomic, stat.Mode())
+		}
+	}
+}
+
+func TestSaveFailedWrite(t *testing.T) {
+	for _, atomic := range []bool{false, true} {
+		for _, mode := range []SaveMode{SaveFail, SaveBackup} {
+			dir := t.TempDir()
+			filename := filepath.Join(dir, "sub.srt")
+			if mode == SaveBackup {
+				os.WriteFile(filename, []byte("old"), 0644)
+			}
+
+			_, e := saveFile(filename, failReader{}, SaveOptions{Mode: mode, Atomic: atomic})
+			if e == nil {
+				t.Errorf("mode %d atomic %t: no error", mode, atomic)
+			}
+			entries, _ := os.ReadDir(dir)
+			switch {
+			case mode == SaveFail && len(entries) != 0:
+				t.Errorf("mode %d atomic %t: %d files left, want none", mode, atomic, len(entries))
+
+			case mode == SaveBackup && (len(entries) != 1 || readFile(t, filename) != "old"):
+				t.Errorf("mode %d atomic %t: %d files, %q, want the old file restored", mode, atomic, len(entries), readFile(t, filename))
+			}
+		}
+	}
+}
+
+func TestSaveAtomicNoLink(t *testing.T) {
+	defer func(link func(string, string) error) { linkFile = link }(linkFile)
+	linkFile = func(string, string) error {
+		return &os.LinkError{Op: "link", Err: syscall.EPERM} // Like FAT or SMB.
+	}
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "sub.srt")
+	got, e := saveFile(filename, strings.NewReader("new"), SaveOptions{Atomic: true})
+	if e != nil || got != filename || readFile(t, filename) != "new" {
+		t.Errorf("saveFile() = %q, %v, content %q", got, e, readFile(t, filename))
+	}
+
+	// Created since the check: not replaced.
+	e = writeAtomic(filename, strings.NewReader("other"), 0644, false, false)
+	if !errors.Is(e, fs.ErrExist) || readFile(t, filename) != "new" {
+		t.Errorf("writeAtomic(existing) = %v, content %q, want fs.ErrExist", e, readFile(t, filename))
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("%d files, want 1: no temporary file left", len(entries))
+	}
+}
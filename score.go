@@ -0,0 +1,185 @@
+package opensubs
+
+import (
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//-----------------------------------------------------------------------
+// Scoring.
+//-----------------------------------------------------------------------
+
+// Score is the score of a candidate subtitle, with the details of each
+// criterion, so the choice can be explained and tuned.
+//
+type Score struct {
+	Total float64            // Sum of the parts.
+	Parts map[string]float64 // Weighted score by criterion name.
+}
+
+// Scorer rates candidate subtitles. The best subtitle has the highest total.
+//
+// The filename is the local file the subtitle is searched for, or the search
+// reference (release name, query text) when there's no file. It can be empty.
+//
+type Scorer interface {
+	Score(sub *SubInfo, filename string) Score
+}
+
+// Criteria names used in the DefaultScorer Score parts.
+const (
+	ScoreMatch     = "match"     // Match type: hash, imdb, tag, fulltext.
+	ScoreRelease   = "release"   // Release name similarity to the filename.
+	ScoreFPS       = "fps"       // Frame rate match.
+	ScoreRating    = "rating"    // Subtitle rating.
+	ScoreRank      = "rank"      // Uploader rank.
+	ScoreHearing   = "hearing"   // Hearing impaired preference.
+	ScoreFormat    = "format"    // Preferred format.
+	ScoreDownloads = "downloads" // Download count.
+)
+
+// DefaultScorer combines the main criteria with a weight for each. Each
+// criterion is rated between 0 and 1, then multiplied by its weight.
+//
+type DefaultScorer struct {
+	Weights         map[string]float64 // Weight by criterion name.
+	FPS             float64            // Local video frame rate. 0 if unknown.
+	HearingImpaired bool               // Prefer subtitles for the hearing impaired.
+	Formats         []string           // Preferred formats, best first.
+}
+
+// NewScorer creates a DefaultScorer with the default weights, preferring srt
+// subtitles not made for the hearing impaired.
+//
+func NewScorer() *DefaultScorer {
+	return &DefaultScorer{
+		Weights: map[string]float64{
+			ScoreMatch:     40,
+			ScoreRelease:   20,
+			ScoreFPS:       10,
+			ScoreRating:    10,
+			ScoreRank:      5,
+			ScoreHearing:   5,
+			ScoreFormat:    5,
+			ScoreDownloads: 5,
+		},
+		Formats: []string{"srt"},
+	}
+}
+
+// Uploader ranks, from the most trusted.
+var userRanks = map[string]float64{
+	"administrator":   1,
+	"platinum member": 1,
+	"trusted":         0.9,
+	"gold member":     0.9,
+	"subtranslator":   0.8,
+	"vip member":      0.7,
+	"vip plus member": 0.7,
+	"silver member":   0.6,
+	"bronze member":   0.5,
+	"app developers":  0.5,
+	"translator":      0.5,
+	"sub leecher":     0.1,
+	"":                0.3, // Anonymous.
+}
+
+// Score rates the subtitle.
+//
+func (sc *DefaultScorer) Score(sub *SubInfo, filename string) Score {
+	parts := map[string]float64{
+		ScoreMatch:     float64(4-sub.MatchRank()) / 4,
+		ScoreRelease:   0.5,
+		ScoreFPS:       0.5,
+		ScoreRating:    0.5,
+		ScoreRank:      userRanks[strings.ToLower(sub.UserRank)],
+		ScoreHearing:   0,
+		ScoreFormat:    0,
+		ScoreDownloads: math.Min(1, math.Log10(float64(sub.Downloads())+1)/5),
+	}
+
+	if filename != "" {
+		parts[ScoreRelease] = releaseSimilarity(filename, sub)
+	}
+	if sc.FPS > 0 && sub.FPS() > 0 {
+		parts[ScoreFPS] = 0
+		if math.Abs(sc.FPS-sub.FPS()) < 0.01 {
+			parts[ScoreFPS] = 1
+		}
+	}
+	if sub.Rating() > 0 {
+		parts[ScoreRating] = sub.Rating() / 10
+	}
+	if sub.HearingImpaired() == sc.HearingImpaired {
+		parts[ScoreHearing] = 1
+	}
+	for i, format := range sc.Formats {
+		if strings.EqualFold(format, sub.SubFormat) {
+			parts[ScoreFormat] = 1 - float64(i)/float64(len(sc.Formats))
+			break
+		}
+	}
+
+	score := Score{Parts: parts}
+	for name, value := range parts {
+		parts[name] = value * sc.Weights[name]
+		score.Total += parts[name]
+	}
+	return score
+}
+
+// Rate the similarity of the filename with the subtitle release and file
+// names, from 0 to 1.
+func releaseSimilarity(filename string, sub *SubInfo) float64 {
+	local := releaseTokens(ParseName(filename).Release)
+	best := 0.0
+	for _, name := range []string{sub.MovieReleaseName, strings.TrimSuffix(sub.SubFileName, filepath.Ext(sub.SubFileName))} {
+		if name == "" {
+			continue
+		}
+		other := releaseTokens(name)
+		inter := 0
+		for tok := range other {
+			if local[tok] {
+				inter++
+			}
+		}
+		if union := len(local) + len(other) - inter; union > 0 {
+			best = math.Max(best, float64(inter)/float64(union))
+		}
+	}
+	return best
+}
+
+func releaseTokens(name string) map[string]bool {
+	tokens := make(map[string]bool)
+	for _, tok := range reSplit.Split(strings.ToLower(name), -1) {
+		for _, sub := range strings.Split(tok, "-") {
+			if sub != "" {
+				tokens[sub] = true
+			}
+		}
+	}
+	return tokens
+}
+
+//-----------------------------------------------------------------------
+// Sort by score.
+//-----------------------------------------------------------------------
+
+// Sort the list with the best subtitle first, and set their Scoring.
+// Without scorer, the list is sorted by downloads.
+func sortByScore(list subsList, scorer Scorer, filename string) {
+	if scorer == nil {
+		sort.Sort(byDownloads{list})
+		return
+	}
+	for _, sub := range list {
+		sub.Scoring = scorer.Score(sub, filename)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Scoring.Total > list[j].Scoring.Total
+	})
+}
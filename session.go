@@ -0,0 +1,269 @@
+package opensubs
+
+import (
+	xmlrpc "github.com/sqp/go-xmlrpc"
+
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeepAliveInterval is the default delay between two keep-alive requests.
+// Tokens expire after 15 minutes without activity.
+const KeepAliveInterval = 10 * time.Minute
+
+//-----------------------------------------------------------------------
+// Session.
+//-----------------------------------------------------------------------
+
+// Session holds a login token on the server. It can be shared by many
+// queries, and is safe for concurrent use.
+//
+// The token is requested on first use, and renewed transparently when the
+// server reports it as expired (status 401 or 406).
+//
+type Session struct {
+	client    *Client
+	userAgent string
+	username  string
+	password  string
+	language  string
+	tokenFile string
+
+	mu         sync.Mutex
+	token      string
+	keepAlives map[*KeepAlive]struct{} // Running loops, stopped by Logout.
+
+	quotaMu      sync.Mutex
+	quota        Quota
+	quotaChecked time.Time // Last ServerInfo, even without limits.
+}
+
+// NewSession creates a session for the given account. Empty username and
+// password log in anonymously.
+//
+func NewSession(userAgent, username, password string) *Session {
+	return &Session{
+		client:    DefaultClient,
+		userAgent: userAgent,
+		username:  username,
+		password:  password,
+		language:  "en",
+	}
+}
+
+// SetClient sets the client used to reach the server. (Chainable)
+//
+func (s *Session) SetClient(client *Client) *Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.client = client
+	return s
+}
+
+// SetTokenFile sets a file used to persist the token between runs. The
+// token found there is reused instead of logging in again. (Chainable)
+//
+func (s *Session) SetTokenFile(filename string) *Session {
+	s.tokenFile = filename
+	return s
+}
+
+// Token returns the current token. Empty if not logged in.
+//
+func (s *Session) Token() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.token
+}
+
+// Login requests a new token from the server.
+//
+func (s *Session) Login(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.login(ctx)
+}
+
+// Logout closes the token on the server and removes the token file.
+// The keep-alive loops of the session are stopped, so they don't log in again.
+//
+func (s *Session) Logout(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ka := range s.keepAlives {
+		ka.cancel() // Not waiting: the loop may be blocked on the lock.
+	}
+	clear(s.keepAlives)
+	if s.token == "" {
+		return nil
+	}
+	_, e := s.client.call(ctx, "LogOut", s.token)
+	s.token = ""
+	if s.tokenFile != "" {
+		os.Remove(s.tokenFile)
+	}
+	return e
+}
+
+//-----------------------------------------------------------------------
+// Keep-alive.
+//-----------------------------------------------------------------------
+
+// KeepAlive is a background loop keeping a session token valid.
+//
+type KeepAlive struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// KeepAlive starts a goroutine calling NoOperation on the server every
+// interval (KeepAliveInterval if <= 0), so the token doesn't expire in long
+// running processes. An expired token is renewed like for other calls.
+//
+// Failed requests are reported to onError (can be nil) and the loop goes on.
+// Call Stop on the returned KeepAlive to end it. Logout also ends it.
+//
+func (s *Session) KeepAlive(interval time.Duration, onError func(error)) *KeepAlive {
+	if interval <= 0 {
+		interval = KeepAliveInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ka := &KeepAlive{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	s.mu.Lock()
+	if s.keepAlives == nil {
+		s.keepAlives = make(map[*KeepAlive]struct{})
+	}
+	s.keepAlives[ka] = struct{}{}
+	s.mu.Unlock()
+
+	go func() {
+		defer close(ka.done)
+		defer func() {
+			s.mu.Lock()
+			delete(s.keepAlives, ka)
+			s.mu.Unlock()
+		}()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case <-ticker.C:
+				e := s.noOperation(ctx)
+				if e != nil && ctx.Err() == nil && onError != nil {
+					onError(e)
+				}
+			}
+		}
+	}()
+	return ka
+}
+
+// Stop ends the keep-alive loop, aborting a pending request. It returns when
+// the goroutine has exited. Can be called many times.
+//
+func (ka *KeepAlive) Stop() {
+	ka.cancel()
+	<-ka.done
+}
+
+func (s *Session) noOperation(ctx context.Context) error {
+	_, e := s.call(ctx, "NoOperation")
+	return e
+}
+
+//-----------------------------------------------------------------------
+// Session internals.
+//-----------------------------------------------------------------------
+
+// Process a xmlrpc call with the session token as first argument.
+// The call is retried once with a new token if the current one expired.
+func (s *Session) call(ctx context.Context, name string, args ...interface{}) (xmlrpc.Struct, error) {
+	token, e := s.connect(ctx)
+	if e != nil {
+		return nil, e
+	}
+
+	res, e := s.apiClient().call(ctx, name, append([]interface{}{token}, args...)...)
+	if !tokenExpired(e) {
+		return res, e
+	}
+
+	if e := s.renew(ctx, token); e != nil {
+		return nil, e
+	}
+	return s.apiClient().call(ctx, name, append([]interface{}{s.Token()}, args...)...)
+}
+
+// Get the client, that can be changed by SetClient.
+func (s *Session) apiClient() *Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.client
+}
+
+// Get a valid token: the current one, the saved one, or a new one.
+func (s *Session) connect(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == "" && s.tokenFile != "" {
+		if data, e := os.ReadFile(s.tokenFile); e == nil {
+			s.token = strings.TrimSpace(string(data))
+		}
+	}
+	if s.token == "" {
+		if e := s.login(ctx); e != nil {
+			return "", e
+		}
+	}
+	return s.token, nil
+}
+
+// Login again, unless another call already renewed the expired token.
+func (s *Session) renew(ctx context.Context, expired string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != expired && s.token != "" {
+		return nil
+	}
+	return s.login(ctx)
+}
+
+// Initiate connection to OpenSubtitles.org to get a valid token.
+// The lock must be held.
+func (s *Session) login(ctx context.Context) error {
+	s.token = ""
+	res, e := s.client.call(ctx, "LogIn", s.username, s.password, s.language, s.userAgent)
+	if e != nil {
+		return e
+	}
+
+	token, ok := res["token"].(string)
+	if !ok || token == "" {
+		return errors.New("OpenSubtitles Token problem")
+	}
+	s.token = token
+
+	data, _ := res["data"].(xmlrpc.Struct)
+	for _, fields := range []xmlrpc.Struct{res, data} {
+		if limits, ok := parseDownloadLimits(fields); ok {
+			s.setLimits(limits)
+		}
+	}
+
+	if s.tokenFile != "" {
+		if e := os.WriteFile(s.tokenFile, []byte(token), 0600); e != nil {
+			warn("token file", e)
+		}
+	}
+	return nil
+}
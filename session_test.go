@@ -0,0 +1,49 @@
+package opensubs
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeepAliveLogout(t *testing.T) {
+	var logins, noops atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case strings.Contains(string(body), "<methodName>LogIn<"):
+			logins.Add(1)
+		case strings.Contains(string(body), "<methodName>NoOperation<"):
+			noops.Add(1)
+		}
+		io.WriteString(w, `<methodResponse><params><param><value><struct>`+
+			`<member><name>status</name><value><string>200 OK</string></value></member>`+
+			`<member><name>token</name><value><string>tok</string></value></member>`+
+			`</struct></value></param></params></methodResponse>`)
+	}))
+	defer srv.Close()
+
+	s := NewSession("ua", "", "").SetClient(NewClient(srv.URL))
+	ka := s.KeepAlive(time.Millisecond, nil)
+	defer ka.Stop()
+	for noops.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if e := s.Logout(context.Background()); e != nil {
+		t.Fatal(e)
+	}
+
+	select {
+	case <-ka.done:
+	case <-time.After(time.Second):
+		t.Fatal("keep-alive still running after Logout")
+	}
+	if n := logins.Load(); n != 1 || s.Token() != "" {
+		t.Errorf("%d logins, token %q after Logout, want 1 and none", n, s.Token())
+	}
+}
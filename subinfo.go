@@ -0,0 +1,187 @@
+package opensubs
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Date format of SubAddDate and SubLastTS.
+const subDateFormat = "2006-01-02 15:04:05"
+
+//-----------------------------------------------------------------------
+// SubInfo typed accessors.
+//-----------------------------------------------------------------------
+
+// MatchRank returns the quality of the match type, from the most reliable:
+// 0 moviehash, 1 imdbid, 2 tag, 3 fulltext, 4 unknown.
+func (sub SubInfo) MatchRank() int {
+	switch sub.MatchedBy {
+	case "moviehash":
+		return 0
+	case "imdbid":
+		return 1
+	case "tag":
+		return 2
+	case "fulltext":
+		return 3
+	}
+	return 4
+}
+
+// Downloads returns the number of downloads of the subtitle.
+func (sub SubInfo) Downloads() int { return atoi(sub.SubDownloadsCnt) }
+
+// AddDate returns the upload date of the subtitle. Zero if unknown.
+func (sub SubInfo) AddDate() time.Time {
+	t, _ := time.Parse(subDateFormat, sub.SubAddDate)
+	return t
+}
+
+// Rating returns the subtitle rating, from 0 (not rated) to 10.
+func (sub SubInfo) Rating() float64 { return atof(sub.SubRating) }
+
+// Votes returns the number of votes for the rating.
+func (sub SubInfo) Votes() int { return atoi(sub.SubSumVotes) }
+
+// Bad returns the number of bad subtitle reports.
+func (sub SubInfo) Bad() int { return atoi(sub.SubBad) }
+
+// Size returns the subtitle file size in bytes.
+func (sub SubInfo) Size() int64 { return atoi64(sub.SubSize) }
+
+// CDs returns the number of files (CDs) of the subtitle release.
+func (sub SubInfo) CDs() int { return atoi(sub.SubSumCD) }
+
+// ActualCD returns the CD number of this subtitle file.
+func (sub SubInfo) ActualCD() int { return atoi(sub.SubActualCD) }
+
+// HearingImpaired returns true for subtitles for the hearing impaired (SDH).
+func (sub SubInfo) HearingImpaired() bool { return atob(sub.SubHearingImpaired) }
+
+// HD returns true for subtitles made for a HD release.
+func (sub SubInfo) HD() bool { return atob(sub.SubHD) }
+
+// AutoTranslated returns true for machine translated subtitles.
+func (sub SubInfo) AutoTranslated() bool { return atob(sub.SubAutoTranslation) }
+
+// ForeignPartsOnly returns true for subtitles only covering foreign parts.
+func (sub SubInfo) ForeignPartsOnly() bool { return atob(sub.SubForeignPartsOnly) }
+
+// Trusted returns true for subtitles from a trusted source.
+func (sub SubInfo) Trusted() bool { return atob(sub.SubFromTrusted) }
+
+// Featured returns true for subtitles featured on the website.
+func (sub SubInfo) Featured() bool { return atob(sub.SubFeatured) }
+
+// FPS returns the movie frame rate the subtitle was made for. 0 if unknown.
+func (sub SubInfo) FPS() float64 { return atof(sub.MovieFPS) }
+
+// MovieSize returns the movie file size in bytes.
+func (sub SubInfo) MovieSize() int64 { return atoi64(sub.MovieByteSize) }
+
+// MovieDuration returns the movie duration.
+func (sub SubInfo) MovieDuration() time.Duration {
+	return time.Duration(atoi64(sub.MovieTimeMS)) * time.Millisecond
+}
+
+// Year returns the movie year.
+func (sub SubInfo) Year() int { return atoi(sub.MovieYear) }
+
+// ImdbRating returns the movie rating on imdb.
+func (sub SubInfo) ImdbRating() float64 { return atof(sub.MovieImdbRating) }
+
+// Season returns the series season number. 0 for movies.
+func (sub SubInfo) Season() int { return atoi(sub.SeriesSeason) }
+
+// Episode returns the series episode number. 0 for movies.
+func (sub SubInfo) Episode() int { return atoi(sub.SeriesEpisode) }
+
+// QueryIndex returns the index of the search argument that matched.
+func (sub SubInfo) QueryIndex() int { return atoi(sub.QueryNumber) }
+
+//-----------------------------------------------------------------------
+// SubInfo mapping.
+//-----------------------------------------------------------------------
+
+// List the SubInfo fields by their server name.
+func (sub *SubInfo) fields() map[string]*string {
+	return map[string]*string{
+		"MatchedBy":           &sub.MatchedBy,
+		"IDSubMovieFile":      &sub.IDSubMovieFile,
+		"MovieHash":           &sub.MovieHash,
+		"MovieByteSize":       &sub.MovieByteSize,
+		"MovieTimeMS":         &sub.MovieTimeMS,
+		"IDSubtitleFile":      &sub.IDSubtitleFile,
+		"SubFileName":         &sub.SubFileName,
+		"SubActualCD":         &sub.SubActualCD,
+		"SubSize":             &sub.SubSize,
+		"SubHash":             &sub.SubHash,
+		"SubLastTS":           &sub.SubLastTS,
+		"SubTSGroup":          &sub.SubTSGroup,
+		"SubTSGroupHash":      &sub.SubTSGroupHash,
+		"InfoReleaseGroup":    &sub.InfoReleaseGroup,
+		"InfoFormat":          &sub.InfoFormat,
+		"InfoOther":           &sub.InfoOther,
+		"IDSubtitle":          &sub.IDSubtitle,
+		"UserID":              &sub.UserID,
+		"SubLanguageID":       &sub.SubLanguageID,
+		"SubFormat":           &sub.SubFormat,
+		"SubSumCD":            &sub.SubSumCD,
+		"SubAuthorComment":    &sub.SubAuthorComment,
+		"SubAddDate":          &sub.SubAddDate,
+		"SubBad":              &sub.SubBad,
+		"SubRating":           &sub.SubRating,
+		"SubSumVotes":         &sub.SubSumVotes,
+		"SubDownloadsCnt":     &sub.SubDownloadsCnt,
+		"MovieReleaseName":    &sub.MovieReleaseName,
+		"MovieFPS":            &sub.MovieFPS,
+		"IDMovie":             &sub.IDMovie,
+		"IDMovieImdb":         &sub.IDMovieImdb,
+		"MovieName":           &sub.MovieName,
+		"MovieNameEng":        &sub.MovieNameEng,
+		"MovieYear":           &sub.MovieYear,
+		"MovieImdbRating":     &sub.MovieImdbRating,
+		"MovieKind":           &sub.MovieKind,
+		"SubFeatured":         &sub.SubFeatured,
+		"UserNickName":        &sub.UserNickName,
+		"UserRank":            &sub.UserRank,
+		"SubTranslator":       &sub.SubTranslator,
+		"ISO639":              &sub.ISO639,
+		"LanguageName":        &sub.LanguageName,
+		"SubComments":         &sub.SubComments,
+		"SubHearingImpaired":  &sub.SubHearingImpaired,
+		"SubHD":               &sub.SubHD,
+		"SubEncoding":         &sub.SubEncoding,
+		"SubAutoTranslation":  &sub.SubAutoTranslation,
+		"SubForeignPartsOnly": &sub.SubForeignPartsOnly,
+		"SubFromTrusted":      &sub.SubFromTrusted,
+		"SeriesSeason":        &sub.SeriesSeason,
+		"SeriesEpisode":       &sub.SeriesEpisode,
+		"SeriesIMDBParent":    &sub.SeriesIMDBParent,
+		"SubDownloadLink":     &sub.SubDownloadLink,
+		"ZipDownloadLink":     &sub.ZipDownloadLink,
+		"SubtitlesLink":       &sub.SubtitlesLink,
+		"QueryNumber":         &sub.QueryNumber,
+		"Score":               &sub.Score,
+	}
+}
+
+func atoi(s string) int {
+	i, _ := strconv.Atoi(strings.TrimSpace(s))
+	return i
+}
+
+func atoi64(s string) int64 {
+	i, _ := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	return i
+}
+
+func atof(s string) float64 {
+	f, _ := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return f
+}
+
+func atob(s string) bool {
+	return atoi(s) != 0
+}